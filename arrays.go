@@ -0,0 +1,188 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ArrayThrottleKey groups the job arrays with a limit of simultaneously running
+// tasks by user and partition
+type ArrayThrottleKey struct {
+	user      string
+	partition string
+}
+
+type ArraysMetrics struct {
+	// Distinct job arrays per partition
+	arrays map[string]map[string]bool
+	// Array tasks and regular jobs per state and partition
+	tasks   map[QueueJobsKey]float64
+	regular map[QueueJobsKey]float64
+	// Throttled job arrays and the sum of their limits per user and partition
+	throttled map[ArrayThrottleKey]float64
+	throttle  map[ArrayThrottleKey]float64
+}
+
+// Execute the squeue command without expanding the pending tasks of job arrays
+func ArraysData() []byte {
+	args := []string{"-a", "-h", "--states=all", "-o", "%i|%T|%P|%u"}
+	return Execute("squeue", args)
+}
+
+// ParseArrayTasks takes the unexpanded task IDs of a job array like
+// "1-50000%100" or "1,3,5-11:2" and returns the number of tasks and the
+// limit of simultaneously running tasks (zero if not limited)
+func ParseArrayTasks(input string) (float64, float64) {
+	var tasks, throttle float64
+	parts := strings.SplitN(input, "%", 2)
+	if len(parts) == 2 {
+		throttle, _ = strconv.ParseFloat(parts[1], 64)
+	}
+	for _, item := range strings.Split(parts[0], ",") {
+		step := 1.0
+		if i := strings.Index(item, ":"); i >= 0 {
+			step, _ = strconv.ParseFloat(item[i+1:], 64)
+			item = item[:i]
+		}
+		bounds := strings.SplitN(item, "-", 2)
+		if len(bounds) == 1 {
+			if len(item) > 0 {
+				tasks++
+			}
+			continue
+		}
+		first, err1 := strconv.ParseFloat(bounds[0], 64)
+		last, err2 := strconv.ParseFloat(bounds[1], 64)
+		if err1 != nil || err2 != nil || step < 1 || last < first {
+			continue
+		}
+		tasks += float64(int((last-first)/step)) + 1
+	}
+	return tasks, throttle
+}
+
+// ParseArraysMetrics takes the output of squeue without expanded job arrays
+// It returns the number of job arrays, array tasks and regular jobs
+func ParseArraysMetrics(input []byte) *ArraysMetrics {
+	am := ArraysMetrics{
+		arrays:    make(map[string]map[string]bool),
+		tasks:     make(map[QueueJobsKey]float64),
+		regular:   make(map[QueueJobsKey]float64),
+		throttled: make(map[ArrayThrottleKey]float64),
+		throttle:  make(map[ArrayThrottleKey]float64),
+	}
+	hetSeen := make(map[hetJobKey]bool)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 4 {
+			continue
+		}
+		jobid := strings.TrimSpace(fields[0])
+		state := strings.ToLower(fields[1])
+		for _, partition := range strings.Split(fields[2], ",") {
+			key := QueueJobsKey{state, partition}
+			// Array tasks are listed as "123_5" or for the pending tasks "123_[1-50000%100]"
+			i := strings.Index(jobid, "_")
+			if i < 0 {
+				// The components of a heterogeneous job are counted as one job,
+				// in every partition used by any of its components
+				if id, _, ok := HetJobComponent(jobid); ok {
+					if hetSeen[hetJobKey{id, key}] {
+						continue
+					}
+					hetSeen[hetJobKey{id, key}] = true
+				}
+				am.regular[key]++
+				continue
+			}
+			if _, ok := am.arrays[partition]; !ok {
+				am.arrays[partition] = make(map[string]bool)
+			}
+			am.arrays[partition][jobid[:i]] = true
+			tasks := jobid[i+1:]
+			if !strings.HasPrefix(tasks, "[") {
+				am.tasks[key]++
+				continue
+			}
+			count, throttle := ParseArrayTasks(strings.Trim(tasks, "[]"))
+			am.tasks[key] += count
+			if throttle > 0 {
+				am.throttled[ArrayThrottleKey{fields[3], partition}]++
+				am.throttle[ArrayThrottleKey{fields[3], partition}] += throttle
+			}
+		}
+	}
+	return &am
+}
+
+func ArraysGetMetrics() *ArraysMetrics {
+	return ParseArraysMetrics(ArraysData())
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm job array metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+func NewArraysCollector() *ArraysCollector {
+	labels := []string{"state", "partition"}
+	return &ArraysCollector{
+		arrays:    prometheus.NewDesc("slurm_queue_arrays", "Distinct job arrays in the queue", []string{"partition"}, nil),
+		tasks:     prometheus.NewDesc("slurm_queue_array_tasks", "Job array tasks in the queue, including the pending tasks not yet expanded", labels, nil),
+		regular:   prometheus.NewDesc("slurm_queue_regular_jobs", "Jobs in the queue not being part of a job array", labels, nil),
+		throttled: prometheus.NewDesc("slurm_queue_arrays_throttled", "Job arrays with a limit of simultaneously running tasks", []string{"user", "partition"}, nil),
+		throttle:  prometheus.NewDesc("slurm_queue_array_throttle", "Sum of the limits of simultaneously running tasks of the throttled job arrays", []string{"user", "partition"}, nil),
+	}
+}
+
+type ArraysCollector struct {
+	arrays    *prometheus.Desc
+	tasks     *prometheus.Desc
+	regular   *prometheus.Desc
+	throttled *prometheus.Desc
+	throttle  *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (ac *ArraysCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ac.arrays
+	ch <- ac.tasks
+	ch <- ac.regular
+	ch <- ac.throttled
+	ch <- ac.throttle
+}
+
+func (ac *ArraysCollector) Collect(ch chan<- prometheus.Metric) {
+	am := ArraysGetMetrics()
+	for partition, arrays := range am.arrays {
+		ch <- prometheus.MustNewConstMetric(ac.arrays, prometheus.GaugeValue, float64(len(arrays)), partition)
+	}
+	for key, tasks := range am.tasks {
+		ch <- prometheus.MustNewConstMetric(ac.tasks, prometheus.GaugeValue, tasks, key.state, key.partition)
+	}
+	for key, jobs := range am.regular {
+		ch <- prometheus.MustNewConstMetric(ac.regular, prometheus.GaugeValue, jobs, key.state, key.partition)
+	}
+	for key, arrays := range am.throttled {
+		ch <- prometheus.MustNewConstMetric(ac.throttled, prometheus.GaugeValue, arrays, key.user, key.partition)
+		ch <- prometheus.MustNewConstMetric(ac.throttle, prometheus.GaugeValue, am.throttle[key], key.user, key.partition)
+	}
+}
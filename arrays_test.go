@@ -0,0 +1,54 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseArrayTasks(t *testing.T) {
+	tasks, throttle := ParseArrayTasks("1-50000%100")
+	assert.Equal(t, 50000.0, tasks)
+	assert.Equal(t, 100.0, throttle)
+	tasks, throttle = ParseArrayTasks("1,3,5-11:2")
+	assert.Equal(t, 6.0, tasks)
+	assert.Equal(t, 0.0, throttle)
+}
+
+func TestArraysMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/squeue_arrays.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	am := ParseArraysMetrics(data)
+	t.Logf("%+v", am)
+
+	assert.Len(t, am.arrays["batch"], 2)
+	assert.Len(t, am.arrays["gpu"], 1)
+	assert.Equal(t, 49900.0, am.tasks[QueueJobsKey{"pending", "batch"}])
+	assert.Equal(t, 3.0, am.tasks[QueueJobsKey{"running", "batch"}])
+	assert.Equal(t, 6.0, am.tasks[QueueJobsKey{"pending", "gpu"}])
+	// A heterogeneous job is counted once in every partition of its components
+	assert.Equal(t, 3.0, am.regular[QueueJobsKey{"running", "batch"}])
+	assert.Equal(t, 1.0, am.regular[QueueJobsKey{"running", "gpu"}])
+	assert.Equal(t, 1.0, am.regular[QueueJobsKey{"pending", "gpu-long"}])
+	assert.Equal(t, map[ArrayThrottleKey]float64{{"alice", "batch"}: 1}, am.throttled)
+	assert.Equal(t, map[ArrayThrottleKey]float64{{"alice", "batch"}: 100}, am.throttle)
+}
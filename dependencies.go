@@ -0,0 +1,128 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type DependencyMetrics struct {
+	// Pending jobs per dependency type, e.g. "afterok" or "singleton"
+	types map[string]float64
+	// Age of the oldest job per pending reason related to dependencies
+	oldest map[string]float64
+}
+
+// Execute the squeue command to get the dependencies of the pending jobs
+func DependencyData() []byte {
+	args := []string{"-a", "-r", "-h", "--states=PENDING", "-o", "%A|%r|%V|%E"}
+	return Execute("squeue", args)
+}
+
+// DependencyTypes takes the dependencies of a job as printed by squeue like
+// "afterok:123(unfulfilled),afterany:456+10(unfulfilled)" or "singleton(unfulfilled)"
+// It returns every type of dependency once
+func DependencyTypes(field string) []string {
+	var types []string
+	seen := make(map[string]bool)
+	field = strings.TrimSpace(field)
+	if field == "(null)" {
+		return types
+	}
+	// Dependencies are separated by "," if all of them and "?" if any of them have to be satisfied
+	for _, item := range strings.FieldsFunc(field, func(r rune) bool { return r == ',' || r == '?' }) {
+		name := strings.FieldsFunc(item, func(r rune) bool { return r == ':' || r == '(' })
+		if len(name) == 0 || seen[name[0]] {
+			continue
+		}
+		seen[name[0]] = true
+		types = append(types, name[0])
+	}
+	return types
+}
+
+// ParseDependencyMetrics takes the output of squeue for pending jobs
+// It returns the jobs waiting on dependencies by type and the age of the oldest ones
+func ParseDependencyMetrics(input []byte, now time.Time) *DependencyMetrics {
+	dm := DependencyMetrics{
+		types: make(map[string]float64),
+		// Both reasons are always exported to drop to zero without pending jobs
+		oldest: map[string]float64{"Dependency": 0, "DependencyNeverSatisfied": 0},
+	}
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 4 {
+			continue
+		}
+		reason := strings.TrimSpace(fields[1])
+		// Jobs with satisfied dependencies pending for other reasons are not counted
+		if reason != "Dependency" && reason != "DependencyNeverSatisfied" {
+			continue
+		}
+		for _, dependency := range DependencyTypes(fields[3]) {
+			dm.types[dependency]++
+		}
+		submit, err := ParseSlurmTime(fields[2])
+		if err != nil {
+			continue
+		}
+		if age := now.Sub(submit).Seconds(); age > dm.oldest[reason] {
+			dm.oldest[reason] = age
+		}
+	}
+	return &dm
+}
+
+func DependencyGetMetrics() *DependencyMetrics {
+	return ParseDependencyMetrics(DependencyData(), time.Now())
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * dependency metrics of pending jobs into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+func NewDependencyCollector() *DependencyCollector {
+	return &DependencyCollector{
+		types:  prometheus.NewDesc("slurm_dependency_jobs", "Pending jobs with a dependency of the type", []string{"type"}, nil),
+		oldest: prometheus.NewDesc("slurm_dependency_oldest_pending_seconds", "Time since the submission of the oldest job pending for the reason", []string{"reason"}, nil),
+	}
+}
+
+type DependencyCollector struct {
+	types  *prometheus.Desc
+	oldest *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (dc *DependencyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- dc.types
+	ch <- dc.oldest
+}
+
+func (dc *DependencyCollector) Collect(ch chan<- prometheus.Metric) {
+	dm := DependencyGetMetrics()
+	for dependency, jobs := range dm.types {
+		ch <- prometheus.MustNewConstMetric(dc.types, prometheus.GaugeValue, jobs, dependency)
+	}
+	for reason, age := range dm.oldest {
+		ch <- prometheus.MustNewConstMetric(dc.oldest, prometheus.GaugeValue, age, reason)
+	}
+}
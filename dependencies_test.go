@@ -0,0 +1,49 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDependencyTypes(t *testing.T) {
+	assert.Equal(t, []string{"afterok", "afterany"}, DependencyTypes("afterok:1(unfulfilled),afterany:2+10(unfulfilled),afterok:3(unfulfilled)"))
+	assert.Equal(t, []string{"singleton"}, DependencyTypes("singleton(unfulfilled)"))
+	assert.Empty(t, DependencyTypes("(null)"))
+	assert.Empty(t, DependencyTypes(""))
+}
+
+func TestDependencyMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/squeue_dependencies.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	now := time.Date(2021, 3, 4, 12, 0, 0, 0, time.Local)
+	dm := ParseDependencyMetrics(data, now)
+	t.Logf("%+v", dm)
+
+	assert.Equal(t, map[string]float64{"afterok": 3, "afterany": 2, "afternotok": 1, "singleton": 1, "aftercorr": 1}, dm.types)
+	assert.Equal(t, 3*3600.0, dm.oldest["Dependency"])
+	assert.Equal(t, 3*86400.0, dm.oldest["DependencyNeverSatisfied"])
+
+	dm = ParseDependencyMetrics([]byte("5006|Priority|2021-03-04T11:45:00|(null)\n"), now)
+	assert.Equal(t, map[string]float64{"Dependency": 0, "DependencyNeverSatisfied": 0}, dm.oldest)
+}
@@ -0,0 +1,257 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Buckets of the efficiency histograms, jobs may slightly exceed an
+// efficiency of 1 by the overhead of their processes
+var efficiencyBuckets = []float64{0.05, 0.1, 0.25, 0.5, 0.75, 0.9, 1}
+
+// EfficiencyKey groups the efficiency of finished jobs
+type EfficiencyKey struct {
+	account   string
+	user      string
+	partition string
+}
+
+// EfficiencyMetrics stores the efficiency of the jobs finished within a time window,
+// memory in bytes
+type EfficiencyMetrics struct {
+	cpuEfficiency []float64
+	cpuAlloc      float64
+	cpuUsed       float64
+	memEfficiency []float64
+	memRequested  float64
+	memUsed       float64
+	oom           float64
+}
+
+// AccumulatedHistogram keeps the observations of a histogram across polls
+type AccumulatedHistogram struct {
+	count   uint64
+	sum     float64
+	buckets map[float64]uint64
+}
+
+// Observe adds values to the histogram
+func (h *AccumulatedHistogram) Observe(values []float64, bounds []float64) {
+	count, sum, buckets := HistogramBuckets(values, bounds)
+	if h.buckets == nil {
+		h.buckets = make(map[float64]uint64)
+	}
+	h.count += count
+	h.sum += sum
+	for bound, n := range buckets {
+		h.buckets[bound] += n
+	}
+}
+
+// Fields requested from sacct for the efficiency of finished jobs, the steps
+// of a job only provide its MaxRSS
+const efficiencyFormat = "JobID,Account,User,Partition,AllocCPUS,ElapsedRaw,TotalCPU,End,State,ReqMem,NNodes,MaxRSS"
+
+// ParseSlurmMemory converts a memory size printed by sacct like "1536K" or
+// "4G" to bytes, unit is the multiplier of sizes without suffix
+func ParseSlurmMemory(field string, unit float64) (float64, error) {
+	field = strings.TrimSpace(field)
+	multipliers := map[string]float64{"K": 1 << 10, "M": 1 << 20, "G": 1 << 30, "T": 1 << 40}
+	if len(field) > 0 {
+		if multiplier, ok := multipliers[field[len(field)-1:]]; ok {
+			unit = multiplier
+			field = field[:len(field)-1]
+		}
+	}
+	size, err := strconv.ParseFloat(field, 64)
+	return size * unit, err
+}
+
+// ParseRequestedMemory converts the ReqMem of a job to bytes per node. Older
+// Slurm versions print the memory per CPU ("4000Mc") or per node ("64Gn"),
+// recent versions print the memory of the whole job without a suffix
+func ParseRequestedMemory(field string, cpus float64, nodes float64) (float64, error) {
+	field = strings.TrimSpace(field)
+	if nodes < 1 {
+		nodes = 1
+	}
+	switch {
+	case strings.HasSuffix(field, "c"):
+		perCPU, err := ParseSlurmMemory(strings.TrimSuffix(field, "c"), 1<<20)
+		return perCPU * cpus / nodes, err
+	case strings.HasSuffix(field, "n"):
+		return ParseSlurmMemory(strings.TrimSuffix(field, "n"), 1<<20)
+	}
+	total, err := ParseSlurmMemory(field, 1<<20)
+	return total / nodes, err
+}
+
+// ParseEfficiencyMetrics takes the output of sacct including the job steps and
+// returns the CPU and memory efficiency of all jobs which finished within the
+// time window
+func ParseEfficiencyMetrics(input []byte, start time.Time, end time.Time) map[EfficiencyKey]*EfficiencyMetrics {
+	var jobs [][]string
+	// Largest MaxRSS of the steps of every job
+	maxRSS := make(map[string]float64)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 12 {
+			continue
+		}
+		if i := strings.Index(fields[0], "."); i >= 0 {
+			if rss, err := ParseSlurmMemory(fields[11], 1); err == nil && rss > maxRSS[fields[0][:i]] {
+				maxRSS[fields[0][:i]] = rss
+			}
+			continue
+		}
+		if FinishedWithin(fields[7], start, end) {
+			jobs = append(jobs, fields)
+		}
+	}
+	efficiency := make(map[EfficiencyKey]*EfficiencyMetrics)
+	for _, fields := range jobs {
+		key := EfficiencyKey{fields[1], fields[2], fields[3]}
+		if _, ok := efficiency[key]; !ok {
+			efficiency[key] = &EfficiencyMetrics{}
+		}
+		em := efficiency[key]
+		if FinishedState(fields[8]) == "out_of_memory" {
+			em.oom++
+		}
+		cpus, _ := strconv.ParseFloat(fields[4], 64)
+		elapsed, _ := strconv.ParseFloat(fields[5], 64)
+		// Jobs cancelled before they started have no allocation
+		if cpus*elapsed == 0 {
+			continue
+		}
+		if used, err := ParseSlurmDuration(fields[6]); err == nil {
+			em.cpuAlloc += cpus * elapsed
+			em.cpuUsed += used
+			em.cpuEfficiency = append(em.cpuEfficiency, used/(cpus*elapsed))
+		}
+		// MaxRSS is the peak of a single node, hence it is compared with the memory requested per node
+		nodes, _ := strconv.ParseFloat(fields[10], 64)
+		requested, err := ParseRequestedMemory(fields[9], cpus, nodes)
+		rss, found := maxRSS[fields[0]]
+		if err != nil || requested == 0 || !found {
+			continue
+		}
+		if nodes < 1 {
+			nodes = 1
+		}
+		em.memRequested += requested * nodes
+		em.memUsed += rss * nodes
+		em.memEfficiency = append(em.memEfficiency, rss/requested)
+	}
+	return efficiency
+}
+
+// EfficiencyTotals accumulates the efficiency of finished jobs across polls
+type EfficiencyTotals struct {
+	cpuEfficiency AccumulatedHistogram
+	cpuAlloc      float64
+	cpuUsed       float64
+	memEfficiency AccumulatedHistogram
+	memRequested  float64
+	memUsed       float64
+	oom           float64
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * efficiency of finished jobs from the accounting database into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// NewEfficiencyCollector returns a collector for the efficiency of finished
+// jobs, the cursor is persisted to cursorPath unless it is empty
+func NewEfficiencyCollector(cursorPath string, settle time.Duration) *EfficiencyCollector {
+	labels := []string{"account", "user", "partition"}
+	return &EfficiencyCollector{
+		cursor:        NewSacctCursor(cursorPath, settle),
+		totals:        make(map[EfficiencyKey]*EfficiencyTotals),
+		cpuEfficiency: prometheus.NewDesc("slurm_jobs_cpu_efficiency", "CPU efficiency of finished jobs, CPU time used divided by CPU time allocated", labels, nil),
+		cpuAlloc:      prometheus.NewDesc("slurm_jobs_cpu_alloc_seconds_total", "CPU time allocated to finished jobs", labels, nil),
+		cpuUsed:       prometheus.NewDesc("slurm_jobs_cpu_used_seconds_total", "CPU time used by finished jobs", labels, nil),
+		memEfficiency: prometheus.NewDesc("slurm_jobs_mem_efficiency", "Memory efficiency of finished jobs, peak memory used divided by memory requested per node", labels, nil),
+		memRequested:  prometheus.NewDesc("slurm_jobs_mem_requested_bytes_total", "Memory requested by finished jobs", labels, nil),
+		memUsed:       prometheus.NewDesc("slurm_jobs_mem_used_bytes_total", "Peak memory used by finished jobs, estimated from the largest peak of a node", labels, nil),
+		oom:           prometheus.NewDesc("slurm_jobs_oom_total", "Finished jobs killed with OUT_OF_MEMORY", labels, nil),
+	}
+}
+
+type EfficiencyCollector struct {
+	mutex         sync.Mutex
+	cursor        *SacctCursor
+	totals        map[EfficiencyKey]*EfficiencyTotals
+	cpuEfficiency *prometheus.Desc
+	cpuAlloc      *prometheus.Desc
+	cpuUsed       *prometheus.Desc
+	memEfficiency *prometheus.Desc
+	memRequested  *prometheus.Desc
+	memUsed       *prometheus.Desc
+	oom           *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (ec *EfficiencyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- ec.cpuEfficiency
+	ch <- ec.cpuAlloc
+	ch <- ec.cpuUsed
+	ch <- ec.memEfficiency
+	ch <- ec.memRequested
+	ch <- ec.memUsed
+	ch <- ec.oom
+}
+
+func (ec *EfficiencyCollector) Collect(ch chan<- prometheus.Metric) {
+	ec.mutex.Lock()
+	defer ec.mutex.Unlock()
+	start, end := ec.cursor.Window(time.Now())
+	if end.After(start) {
+		for key, em := range ParseEfficiencyMetrics(FinishedStepsData(start, end, efficiencyFormat), start, end) {
+			if _, ok := ec.totals[key]; !ok {
+				ec.totals[key] = &EfficiencyTotals{}
+			}
+			et := ec.totals[key]
+			et.cpuEfficiency.Observe(em.cpuEfficiency, efficiencyBuckets)
+			et.cpuAlloc += em.cpuAlloc
+			et.cpuUsed += em.cpuUsed
+			et.memEfficiency.Observe(em.memEfficiency, efficiencyBuckets)
+			et.memRequested += em.memRequested
+			et.memUsed += em.memUsed
+			et.oom += em.oom
+		}
+		ec.cursor.Advance(end)
+	}
+	for key, et := range ec.totals {
+		h := et.cpuEfficiency
+		ch <- prometheus.MustNewConstHistogram(ec.cpuEfficiency, h.count, h.sum, h.buckets, key.account, key.user, key.partition)
+		h = et.memEfficiency
+		ch <- prometheus.MustNewConstHistogram(ec.memEfficiency, h.count, h.sum, h.buckets, key.account, key.user, key.partition)
+		ch <- prometheus.MustNewConstMetric(ec.cpuAlloc, prometheus.CounterValue, et.cpuAlloc, key.account, key.user, key.partition)
+		ch <- prometheus.MustNewConstMetric(ec.cpuUsed, prometheus.CounterValue, et.cpuUsed, key.account, key.user, key.partition)
+		ch <- prometheus.MustNewConstMetric(ec.memRequested, prometheus.CounterValue, et.memRequested, key.account, key.user, key.partition)
+		ch <- prometheus.MustNewConstMetric(ec.memUsed, prometheus.CounterValue, et.memUsed, key.account, key.user, key.partition)
+		ch <- prometheus.MustNewConstMetric(ec.oom, prometheus.CounterValue, et.oom, key.account, key.user, key.partition)
+	}
+}
@@ -0,0 +1,85 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSlurmMemory(t *testing.T) {
+	size, err := ParseSlurmMemory("1536K", 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1536.0*1024, size)
+	size, _ = ParseSlurmMemory("0", 1)
+	assert.Equal(t, 0.0, size)
+	_, err = ParseSlurmMemory("", 1)
+	assert.Error(t, err)
+
+	requested, _ := ParseRequestedMemory("4000Mc", 8, 2)
+	assert.Equal(t, 16000.0*(1<<20), requested)
+	requested, _ = ParseRequestedMemory("64Gn", 8, 2)
+	assert.Equal(t, 64.0*(1<<30), requested)
+	requested, _ = ParseRequestedMemory("64000", 8, 2)
+	assert.Equal(t, 32000.0*(1<<20), requested)
+}
+
+func TestEfficiencyMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/sacct_efficiency.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	start := time.Date(2021, 3, 4, 10, 0, 0, 0, time.Local)
+	end := time.Date(2021, 3, 4, 11, 0, 0, 0, time.Local)
+	efficiency := ParseEfficiencyMetrics(data, start, end)
+	t.Logf("%+v", efficiency)
+
+	// Job 4240 ended at the start of the window, job 4246 after its end and job 4244 never ran
+	assert.Len(t, efficiency, 3)
+	alice := efficiency[EfficiencyKey{"vision", "alice", "gpu"}]
+	assert.Equal(t, []float64{0.5}, alice.cpuEfficiency)
+	assert.Equal(t, 8*3600.0, alice.cpuAlloc)
+	assert.Equal(t, 4*3600.0, alice.cpuUsed)
+	bob := efficiency[EfficiencyKey{"chemistry", "bob", "batch"}]
+	assert.InDeltaSlice(t, []float64{1.0 / 32, 0.75}, bob.cpuEfficiency, 1e-9)
+	assert.Equal(t, 32*5400.0, bob.cpuAlloc)
+	carol := efficiency[EfficiencyKey{"chemistry", "carol", "batch"}]
+	assert.Equal(t, 540.5, carol.cpuUsed)
+
+	// The peak memory of a job is the largest MaxRSS of its steps
+	assert.Equal(t, []float64{0.25}, alice.memEfficiency)
+	assert.Equal(t, 32.0*(1<<30), alice.memRequested)
+	assert.Equal(t, 8.0*(1<<30), alice.memUsed)
+	// 4000M per CPU on 2 nodes and 128G for the job on 2 nodes
+	assert.Equal(t, []float64{1000.0 / 64000, 1}, bob.memEfficiency)
+	assert.Equal(t, 128000.0*(1<<20)+128*(1<<30), bob.memRequested)
+	assert.Equal(t, 1.0, bob.oom)
+	// Job 4245 has no MaxRSS recorded
+	assert.Empty(t, carol.memEfficiency)
+	assert.Equal(t, 0.0, carol.memRequested)
+
+	var h AccumulatedHistogram
+	h.Observe(bob.cpuEfficiency, efficiencyBuckets)
+	h.Observe(alice.cpuEfficiency, efficiencyBuckets)
+	assert.Equal(t, uint64(3), h.count)
+	assert.Equal(t, uint64(1), h.buckets[0.05])
+	assert.Equal(t, uint64(2), h.buckets[0.5])
+	assert.Equal(t, uint64(3), h.buckets[0.75])
+}
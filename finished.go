@@ -0,0 +1,151 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// FinishedKey groups the finished jobs
+type FinishedKey struct {
+	state     string
+	partition string
+	account   string
+}
+
+// ExitCodeKey groups the finished jobs by exit code or by signal
+type ExitCodeKey struct {
+	value     string
+	partition string
+	account   string
+}
+
+type FinishedMetrics struct {
+	jobs      map[FinishedKey]float64
+	exitCodes map[ExitCodeKey]float64
+	signals   map[ExitCodeKey]float64
+}
+
+// Fields requested from sacct for the finished jobs
+const finishedFormat = "JobID,State,Partition,Account,End,ExitCode"
+
+// FinishedState turns a state printed by sacct like "CANCELLED by 1001"
+// into a label like "cancelled"
+func FinishedState(field string) string {
+	state := strings.Fields(field)
+	if len(state) == 0 {
+		return ""
+	}
+	return strings.ToLower(state[0])
+}
+
+// ParseFinishedMetrics takes the output of sacct and counts the jobs which
+// finished within the time window by state, exit code and signal
+func ParseFinishedMetrics(input []byte, start time.Time, end time.Time) *FinishedMetrics {
+	fm := FinishedMetrics{
+		jobs:      make(map[FinishedKey]float64),
+		exitCodes: make(map[ExitCodeKey]float64),
+		signals:   make(map[ExitCodeKey]float64),
+	}
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 6 || !FinishedWithin(fields[4], start, end) {
+			continue
+		}
+		fm.jobs[FinishedKey{FinishedState(fields[1]), fields[2], fields[3]}]++
+		// The exit code is printed as "<exit code>:<signal>"
+		exitCode := strings.SplitN(strings.TrimSpace(fields[5]), ":", 2)
+		if len(exitCode) != 2 {
+			continue
+		}
+		fm.exitCodes[ExitCodeKey{exitCode[0], fields[2], fields[3]}]++
+		if exitCode[1] != "0" {
+			fm.signals[ExitCodeKey{exitCode[1], fields[2], fields[3]}]++
+		}
+	}
+	return &fm
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * finished jobs accumulated from the accounting database into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// NewFinishedCollector returns a collector for the number of finished jobs,
+// the cursor is persisted to cursorPath unless it is empty
+func NewFinishedCollector(cursorPath string, settle time.Duration) *FinishedCollector {
+	labels := []string{"state", "partition", "account"}
+	return &FinishedCollector{
+		cursor: NewSacctCursor(cursorPath, settle),
+		finished: &FinishedMetrics{
+			jobs:      make(map[FinishedKey]float64),
+			exitCodes: make(map[ExitCodeKey]float64),
+			signals:   make(map[ExitCodeKey]float64),
+		},
+		jobs:      prometheus.NewDesc("slurm_jobs_finished_total", "Jobs finished by state, partition and account", labels, nil),
+		exitCodes: prometheus.NewDesc("slurm_jobs_exit_code_total", "Jobs finished by exit code, partition and account", []string{"exit_code", "partition", "account"}, nil),
+		signals:   prometheus.NewDesc("slurm_jobs_signal_total", "Jobs terminated by a signal, by signal number, partition and account", []string{"signal", "partition", "account"}, nil),
+	}
+}
+
+type FinishedCollector struct {
+	mutex     sync.Mutex
+	cursor    *SacctCursor
+	finished  *FinishedMetrics
+	jobs      *prometheus.Desc
+	exitCodes *prometheus.Desc
+	signals   *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (fc *FinishedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- fc.jobs
+	ch <- fc.exitCodes
+	ch <- fc.signals
+}
+
+func (fc *FinishedCollector) Collect(ch chan<- prometheus.Metric) {
+	fc.mutex.Lock()
+	defer fc.mutex.Unlock()
+	start, end := fc.cursor.Window(time.Now())
+	if end.After(start) {
+		fm := ParseFinishedMetrics(FinishedJobsData(start, end, finishedFormat), start, end)
+		for key, jobs := range fm.jobs {
+			fc.finished.jobs[key] += jobs
+		}
+		for key, jobs := range fm.exitCodes {
+			fc.finished.exitCodes[key] += jobs
+		}
+		for key, jobs := range fm.signals {
+			fc.finished.signals[key] += jobs
+		}
+		fc.cursor.Advance(end)
+	}
+	for key, jobs := range fc.finished.jobs {
+		ch <- prometheus.MustNewConstMetric(fc.jobs, prometheus.CounterValue, jobs, key.state, key.partition, key.account)
+	}
+	for key, jobs := range fc.finished.exitCodes {
+		ch <- prometheus.MustNewConstMetric(fc.exitCodes, prometheus.CounterValue, jobs, key.value, key.partition, key.account)
+	}
+	for key, jobs := range fc.finished.signals {
+		ch <- prometheus.MustNewConstMetric(fc.signals, prometheus.CounterValue, jobs, key.value, key.partition, key.account)
+	}
+}
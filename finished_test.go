@@ -0,0 +1,55 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFinishedMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/sacct_finished.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	start := time.Date(2021, 3, 4, 10, 0, 0, 0, time.Local)
+	end := time.Date(2021, 3, 4, 11, 0, 0, 0, time.Local)
+	fm := ParseFinishedMetrics(data, start, end)
+	t.Logf("%+v", fm)
+
+	// Job 4240 ended at the start of the window and job 4247 after its end
+	assert.Len(t, fm.jobs, 5)
+	assert.Equal(t, 2.0, fm.jobs[FinishedKey{"completed", "gpu", "vision"}])
+	assert.Equal(t, 2.0, fm.jobs[FinishedKey{"failed", "batch", "chemistry"}])
+	assert.Equal(t, 1.0, fm.jobs[FinishedKey{"cancelled", "batch", "chemistry"}])
+	assert.Equal(t, 1.0, fm.jobs[FinishedKey{"out_of_memory", "gpu", "vision"}])
+	assert.Equal(t, 0.0, fm.jobs[FinishedKey{"node_fail", "batch", "chemistry"}])
+
+	assert.Equal(t, map[ExitCodeKey]float64{
+		{"0", "gpu", "vision"}:      3,
+		{"0", "batch", "chemistry"}: 3,
+		{"1", "batch", "chemistry"}: 1,
+	}, fm.exitCodes)
+	assert.Equal(t, map[ExitCodeKey]float64{
+		{"125", "gpu", "vision"}:     1,
+		{"15", "batch", "chemistry"}: 1,
+		{"9", "batch", "chemistry"}:  1,
+	}, fm.signals)
+}
@@ -29,6 +29,15 @@ type GPUsMetrics struct {
 	idle        float64
 	total       float64
 	utilization float64
+	pending     map[PendingGPUsKey]float64
+	fragments   map[GPUFragmentationKey]*GPUFragmentationMetrics
+}
+
+// PendingGPUsKey groups the GPUs requested by pending jobs
+type PendingGPUsKey struct {
+	partition string
+	gpuType   string
+	reason    string
 }
 
 func GPUsGetMetrics() *GPUsMetrics {
@@ -75,6 +84,127 @@ func ParseTotalGPUs() float64 {
 	return num_gpus
 }
 
+// ParseNodeCount takes the number of nodes of a job, which is a range like
+// "2-4" for pending jobs with a flexible number of nodes, and returns the minimum
+func ParseNodeCount(field string) float64 {
+	nodes, _ := strconv.ParseFloat(strings.SplitN(field, "-", 2)[0], 64)
+	if nodes < 1 {
+		nodes = 1
+	}
+	return nodes
+}
+
+// JobRequestedGPUs takes the fields of a job printed by scontrol and returns
+// the GPUs per type requested per node (--gres, --gpus-per-node), per job
+// (--gpus) and per task (--gpus-per-task)
+func JobRequestedGPUs(fields map[string]string) map[string]float64 {
+	gpus := make(map[string]float64)
+	tasks, _ := strconv.ParseFloat(fields["NumTasks"], 64)
+	if tasks < 1 {
+		tasks = 1
+	}
+	requests := []struct {
+		field string
+		count float64
+	}{
+		{"TresPerNode", ParseNodeCount(fields["NumNodes"])},
+		{"TresPerJob", 1},
+		{"TresPerTask", tasks},
+	}
+	for _, request := range requests {
+		for key, count := range ParseGRESRequest(fields[request.field]) {
+			if key.name == "gpu" && count > 0 {
+				gpus[key.gresType] += count * request.count
+			}
+		}
+	}
+	return gpus
+}
+
+// ParsePendingGPUs takes the output of "scontrol show job" and sums up the GPUs
+// requested by pending jobs per partition, GPU type and pending reason. Jobs
+// submitted to multiple partitions are accounted for in every one of them.
+func ParsePendingGPUs(input []byte) map[PendingGPUsKey]float64 {
+	pending := make(map[PendingGPUsKey]float64)
+	for _, job := range ParseScontrolJobs(input) {
+		if job.fields["JobState"] != "PENDING" {
+			continue
+		}
+		jobs, partitions := PendingJobShares(job)
+		// Only the name of the reason is kept, e.g. "ReqNodeNotAvail,_UnavailableNodes:gpu01"
+		reason := strings.SplitN(job.fields["Reason"], ",", 2)[0]
+		for gpuType, count := range JobRequestedGPUs(job.fields) {
+			for _, partition := range partitions {
+				pending[PendingGPUsKey{partition, gpuType, reason}] += count * jobs
+			}
+		}
+	}
+	return pending
+}
+
+// GPUFragmentationKey groups the nodes by partition and GPU type
+type GPUFragmentationKey struct {
+	partition string
+	gpuType   string
+}
+
+// GPUFragmentationMetrics describes how the idle GPUs are spread over the nodes
+type GPUFragmentationMetrics struct {
+	nodesFree    float64
+	nodesPartial float64
+	freePerNode  []float64
+}
+
+// Upper bounds of the histogram of free GPUs per node
+var gpuFragmentationBuckets = []float64{0, 1, 2, 3, 4, 5, 6, 7, 8, 16}
+
+// GPUNodeAvailable checks if a node in the given state accepts new jobs
+func GPUNodeAvailable(state string) bool {
+	// Not responding nodes are flagged with an asterisk
+	if strings.Contains(state, "*") || strings.Contains(state, "drain") {
+		return false
+	}
+	for _, prefix := range []string{"idle", "mix", "alloc", "comp"} {
+		if strings.HasPrefix(state, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseGPUFragmentation takes the output of sinfo with the GRES of every node
+// It returns the distribution of free GPUs over the available nodes, the GPUs
+// of nodes without idle CPUs are not usable by new jobs and not counted as free
+func ParseGPUFragmentation(input []byte) map[GPUFragmentationKey]*GPUFragmentationMetrics {
+	fragments := make(map[GPUFragmentationKey]*GPUFragmentationMetrics)
+	for _, ng := range ParseGRESNodes(input) {
+		if !GPUNodeAvailable(ng.state) {
+			continue
+		}
+		for key, gm := range ng.gres {
+			if key.name != "gpu" || gm.total == 0 {
+				continue
+			}
+			fk := GPUFragmentationKey{ng.partition, key.gresType}
+			if _, ok := fragments[fk]; !ok {
+				fragments[fk] = &GPUFragmentationMetrics{}
+			}
+			free := gm.idle
+			if ng.cpusIdle == 0 {
+				free = 0
+			}
+			switch {
+			case free == gm.total:
+				fragments[fk].nodesFree++
+			case free > 0:
+				fragments[fk].nodesPartial++
+			}
+			fragments[fk].freePerNode = append(fragments[fk].freePerNode, free)
+		}
+	}
+	return fragments
+}
+
 func ParseGPUsMetrics() *GPUsMetrics {
 	var gm GPUsMetrics
 	total_gpus := ParseTotalGPUs()
@@ -83,6 +213,8 @@ func ParseGPUsMetrics() *GPUsMetrics {
 	gm.idle = total_gpus - allocated_gpus
 	gm.total = total_gpus
 	gm.utilization = allocated_gpus / total_gpus
+	gm.pending = ParsePendingGPUs(ScontrolJobsData())
+	gm.fragments = ParseGPUFragmentation(GRESData())
 	return &gm
 }
 
@@ -115,14 +247,22 @@ func NewGPUsCollector() *GPUsCollector {
 		idle:  prometheus.NewDesc("slurm_gpus_idle", "Idle GPUs", nil, nil),
 		total: prometheus.NewDesc("slurm_gpus_total", "Total GPUs", nil, nil),
 		utilization: prometheus.NewDesc("slurm_gpus_utilization", "Total GPU utilization", nil, nil),
+		pending: prometheus.NewDesc("slurm_gpus_pending", "GPUs requested by pending jobs", []string{"partition", "type", "reason"}, nil),
+		nodesFree: prometheus.NewDesc("slurm_gpus_nodes_free", "Available nodes with all GPUs free", []string{"partition", "type"}, nil),
+		nodesPartial: prometheus.NewDesc("slurm_gpus_nodes_partially_free", "Available nodes with some of their GPUs free", []string{"partition", "type"}, nil),
+		freePerNode: prometheus.NewDesc("slurm_gpus_free_per_node", "Distribution of free GPUs over the available nodes", []string{"partition", "type"}, nil),
 	}
 }
 
 type GPUsCollector struct {
-	alloc       *prometheus.Desc
-	idle        *prometheus.Desc
-	total       *prometheus.Desc
-	utilization *prometheus.Desc
+	alloc        *prometheus.Desc
+	idle         *prometheus.Desc
+	total        *prometheus.Desc
+	utilization  *prometheus.Desc
+	pending      *prometheus.Desc
+	nodesFree    *prometheus.Desc
+	nodesPartial *prometheus.Desc
+	freePerNode  *prometheus.Desc
 }
 
 // Send all metric descriptions
@@ -131,6 +271,10 @@ func (cc *GPUsCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cc.idle
 	ch <- cc.total
 	ch <- cc.utilization
+	ch <- cc.pending
+	ch <- cc.nodesFree
+	ch <- cc.nodesPartial
+	ch <- cc.freePerNode
 }
 func (cc *GPUsCollector) Collect(ch chan<- prometheus.Metric) {
 	cm := GPUsGetMetrics()
@@ -138,4 +282,13 @@ func (cc *GPUsCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(cc.idle, prometheus.GaugeValue, cm.idle)
 	ch <- prometheus.MustNewConstMetric(cc.total, prometheus.GaugeValue, cm.total)
 	ch <- prometheus.MustNewConstMetric(cc.utilization, prometheus.GaugeValue, cm.utilization)
+	for key, gpus := range cm.pending {
+		ch <- prometheus.MustNewConstMetric(cc.pending, prometheus.GaugeValue, gpus, key.partition, key.gpuType, key.reason)
+	}
+	for key, fm := range cm.fragments {
+		ch <- prometheus.MustNewConstMetric(cc.nodesFree, prometheus.GaugeValue, fm.nodesFree, key.partition, key.gpuType)
+		ch <- prometheus.MustNewConstMetric(cc.nodesPartial, prometheus.GaugeValue, fm.nodesPartial, key.partition, key.gpuType)
+		count, sum, buckets := HistogramBuckets(fm.freePerNode, gpuFragmentationBuckets)
+		ch <- prometheus.MustNewConstHistogram(cc.freePerNode, count, sum, buckets, key.partition, key.gpuType)
+	}
 }
@@ -0,0 +1,65 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingGPUsMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/scontrol_jobs_pending.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	pending := ParsePendingGPUs(data)
+	t.Logf("%+v", pending)
+
+	assert.Len(t, pending, 7)
+	assert.Equal(t, 8.0, pending[PendingGPUsKey{"gpu", "a100", "Resources"}])
+	// GPUs per node are requested for the minimum number of nodes, plus GPUs per job
+	assert.Equal(t, 10.0, pending[PendingGPUsKey{"gpu", "a100", "Priority"}])
+	// GPUs per task
+	assert.Equal(t, 2.0, pending[PendingGPUsKey{"gpu", "", "Resources"}])
+	assert.Equal(t, 2.0, pending[PendingGPUsKey{"gpu-long", "", "Resources"}])
+	assert.Equal(t, 1.0, pending[PendingGPUsKey{"gpu", "", "QOSMaxGRESPerUser"}])
+	// Every pending task of a job array
+	assert.Equal(t, 3.0, pending[PendingGPUsKey{"gpu", "", "Priority"}])
+	assert.Equal(t, 4.0, pending[PendingGPUsKey{"gpu", "", "ReqNodeNotAvail"}])
+
+	assert.Equal(t, 2.0, ParseNodeCount("2-4"))
+	assert.Equal(t, 1.0, ParseNodeCount(""))
+}
+
+func TestGPUFragmentation(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/sinfo_gres.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	fragments := ParseGPUFragmentation(data)
+	t.Logf("%+v", fragments)
+
+	// The free GPU of gpu04 is not usable without idle CPUs
+	a100 := fragments[GPUFragmentationKey{"gpu", "a100"}]
+	assert.Equal(t, 1.0, a100.nodesFree)
+	assert.Equal(t, 1.0, a100.nodesPartial)
+	assert.ElementsMatch(t, []float64{1, 4, 0}, a100.freePerNode)
+	assert.Equal(t, 0.0, fragments[GPUFragmentationKey{"gpu", "1g.5gb"}].nodesFree)
+}
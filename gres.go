@@ -0,0 +1,344 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// GRESKey identifies a generic resource by its name (gpu, nvme, shard, ...)
+// and its optional type (a100, 1g.5gb, ...)
+type GRESKey struct {
+	name     string
+	gresType string
+}
+
+type GRESMetrics struct {
+	alloc float64
+	idle  float64
+	total float64
+}
+
+// NodeGRES stores the generic resources and the idle CPUs of a node within one partition
+type NodeGRES struct {
+	node      string
+	partition string
+	state     string
+	cpusIdle  float64
+	gres      map[GRESKey]*GRESMetrics
+}
+
+// GRESData executes the sinfo command to get the configured and the
+// used generic resources for each node
+func GRESData() []byte {
+	args := []string{"-h", "-N", "-O", "NodeList:100,PartitionName:100,StateLong:50,Gres:500,GresUsed:500,CPUsState:50"}
+	return Execute("sinfo", args)
+}
+
+// SplitGRES splits a comma separated list of generic resources, ignoring
+// the commas within the index lists, e.g. "gpu:a100:3(IDX:0,2-3),nvme:1"
+func SplitGRES(input string) []string {
+	var items []string
+	depth := 0
+	start := 0
+	for i, c := range input {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				items = append(items, input[start:i])
+				start = i + 1
+			}
+		}
+	}
+	items = append(items, input[start:])
+	return items
+}
+
+// ParseGRESCount converts a GRES count with an optional unit suffix into a number
+func ParseGRESCount(count string) float64 {
+	value, _ := parseGRESCount(count)
+	return value
+}
+
+// parseGRESCount converts a count like "4" or "4K" and reports whether the field was a count at all
+func parseGRESCount(count string) (float64, bool) {
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(count, "K"):
+		multiplier = 1024
+	case strings.HasSuffix(count, "M"):
+		multiplier = 1024 * 1024
+	case strings.HasSuffix(count, "G"):
+		multiplier = 1024 * 1024 * 1024
+	case strings.HasSuffix(count, "T"):
+		multiplier = 1024 * 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		count = count[:len(count)-1]
+	}
+	value, err := strconv.ParseFloat(count, 64)
+	if err != nil {
+		return 0, false
+	}
+	return value * multiplier, true
+}
+
+// ParseGRES takes a GRES string as printed by sinfo, for example
+// "gpu:a100:4(S:0-1),nvme:1" or "gpu:a100:no_consume:4", and returns the count per resource
+func ParseGRES(input string) map[GRESKey]float64 {
+	gres := make(map[GRESKey]float64)
+	input = strings.TrimSpace(input)
+	if input == "" || input == "(null)" || input == "N/A" {
+		return gres
+	}
+	for _, item := range SplitGRES(input) {
+		// Drop an unset type and the socket or index information, e.g. "(S:0-1)"
+		item = strings.Replace(item, ":(null)", ":", 1)
+		if i := strings.Index(item, "("); i >= 0 {
+			if j := strings.Index(item[i:], ")"); j >= 0 {
+				item = item[:i] + item[i+j+1:]
+			}
+		}
+		fields := strings.Split(item, ":")
+		if len(fields[0]) == 0 {
+			continue
+		}
+		// The name is followed by an optional type and the count,
+		// flags like "no_consume" may appear in between or after them
+		key := GRESKey{name: fields[0]}
+		count := 1.0
+		for i, field := range fields[1:] {
+			if value, ok := parseGRESCount(field); ok {
+				count = value
+				break
+			}
+			if i == 0 && field != "no_consume" {
+				key.gresType = field
+			}
+		}
+		gres[key] += count
+	}
+	return gres
+}
+
+// ParseGRESRequest takes the GRES requested by a job as printed by squeue,
+// e.g. "gres:gpu:a100:2", "gres/gpu:a100=2" or "gpu:2", and returns the count per resource
+func ParseGRESRequest(input string) map[GRESKey]float64 {
+	var items []string
+	for _, item := range SplitGRES(strings.TrimSpace(input)) {
+		item = strings.TrimPrefix(item, "gres:")
+		item = strings.TrimPrefix(item, "gres/")
+		items = append(items, strings.Replace(item, "=", ":", 1))
+	}
+	return ParseGRES(strings.Join(items, ","))
+}
+
+// ParseGRESNodes takes the output of sinfo with the GRES of every node
+// It returns a list with one entry per node and partition
+func ParseGRESNodes(input []byte) []*NodeGRES {
+	var nodes []*NodeGRES
+	lines := strings.Split(string(input), "\n")
+
+	// Sort and remove all the duplicates from the 'sinfo' output
+	sort.Strings(lines)
+	linesUniq := RemoveDuplicates(lines)
+
+	for _, line := range linesUniq {
+		fields := strings.Fields(line)
+		if len(fields) < 5 {
+			continue
+		}
+		ng := NodeGRES{
+			node:      fields[0],
+			partition: fields[1],
+			state:     fields[2],
+			gres:      make(map[GRESKey]*GRESMetrics),
+		}
+		// The CPUs are printed as "allocated/idle/other/total"
+		if len(fields) > 5 {
+			if cpus := strings.Split(fields[5], "/"); len(cpus) == 4 {
+				ng.cpusIdle, _ = strconv.ParseFloat(cpus[1], 64)
+			}
+		}
+		for key, total := range ParseGRES(fields[3]) {
+			ng.gres[key] = &GRESMetrics{total: total}
+		}
+		for key, alloc := range ParseGRES(fields[4]) {
+			if _, ok := ng.gres[key]; !ok {
+				if alloc == 0 {
+					continue
+				}
+				ng.gres[key] = &GRESMetrics{}
+			}
+			ng.gres[key].alloc = alloc
+		}
+		for _, gm := range ng.gres {
+			gm.idle = gm.total - gm.alloc
+		}
+		nodes = append(nodes, &ng)
+	}
+	return nodes
+}
+
+// GRESClusterMetrics holds the aggregated GRES per cluster, node and partition
+type GRESClusterMetrics struct {
+	cluster    map[GRESKey]*GRESMetrics
+	nodes      map[string]map[GRESKey]*GRESMetrics
+	partitions map[string]map[GRESKey]*GRESMetrics
+}
+
+func addGRESMetrics(m map[GRESKey]*GRESMetrics, key GRESKey, gm *GRESMetrics) {
+	if _, ok := m[key]; !ok {
+		m[key] = &GRESMetrics{}
+	}
+	m[key].alloc += gm.alloc
+	m[key].idle += gm.idle
+	m[key].total += gm.total
+}
+
+// ParseGRESMetrics aggregates the GRES of all nodes, only resources listed
+// in names are considered unless the list is empty
+func ParseGRESMetrics(input []byte, names []string) *GRESClusterMetrics {
+	gcm := GRESClusterMetrics{
+		cluster:    make(map[GRESKey]*GRESMetrics),
+		nodes:      make(map[string]map[GRESKey]*GRESMetrics),
+		partitions: make(map[string]map[GRESKey]*GRESMetrics),
+	}
+	allowed := make(map[string]bool)
+	for _, name := range names {
+		allowed[name] = true
+	}
+	for _, ng := range ParseGRESNodes(input) {
+		// A node belonging to multiple partitions is listed once per partition
+		_, seen := gcm.nodes[ng.node]
+		if !seen {
+			gcm.nodes[ng.node] = make(map[GRESKey]*GRESMetrics)
+		}
+		if _, ok := gcm.partitions[ng.partition]; !ok {
+			gcm.partitions[ng.partition] = make(map[GRESKey]*GRESMetrics)
+		}
+		for key, gm := range ng.gres {
+			if len(allowed) > 0 && !allowed[key.name] {
+				continue
+			}
+			addGRESMetrics(gcm.partitions[ng.partition], key, gm)
+			if !seen {
+				addGRESMetrics(gcm.nodes[ng.node], key, gm)
+				addGRESMetrics(gcm.cluster, key, gm)
+			}
+		}
+	}
+	return &gcm
+}
+
+func GRESGetMetrics(names []string) *GRESClusterMetrics {
+	return ParseGRESMetrics(GRESData(), names)
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm GRES metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// NewGRESCollector returns a collector for the generic resources of the cluster,
+// optionally broken down per node and per partition
+func NewGRESCollector(names []string, perNode bool, perPartition bool) *GRESCollector {
+	labels := []string{"gres", "type"}
+	nodeLabels := []string{"node", "gres", "type"}
+	partitionLabels := []string{"partition", "gres", "type"}
+	return &GRESCollector{
+		names:          names,
+		perNode:        perNode,
+		perPartition:   perPartition,
+		alloc:          prometheus.NewDesc("slurm_gres_alloc", "Allocated generic resources", labels, nil),
+		idle:           prometheus.NewDesc("slurm_gres_idle", "Idle generic resources", labels, nil),
+		total:          prometheus.NewDesc("slurm_gres_total", "Total generic resources", labels, nil),
+		nodeAlloc:      prometheus.NewDesc("slurm_node_gres_alloc", "Allocated generic resources per node", nodeLabels, nil),
+		nodeIdle:       prometheus.NewDesc("slurm_node_gres_idle", "Idle generic resources per node", nodeLabels, nil),
+		nodeTotal:      prometheus.NewDesc("slurm_node_gres_total", "Total generic resources per node", nodeLabels, nil),
+		partitionAlloc: prometheus.NewDesc("slurm_partition_gres_alloc", "Allocated generic resources for partition", partitionLabels, nil),
+		partitionIdle:  prometheus.NewDesc("slurm_partition_gres_idle", "Idle generic resources for partition", partitionLabels, nil),
+		partitionTotal: prometheus.NewDesc("slurm_partition_gres_total", "Total generic resources for partition", partitionLabels, nil),
+	}
+}
+
+type GRESCollector struct {
+	names          []string
+	perNode        bool
+	perPartition   bool
+	alloc          *prometheus.Desc
+	idle           *prometheus.Desc
+	total          *prometheus.Desc
+	nodeAlloc      *prometheus.Desc
+	nodeIdle       *prometheus.Desc
+	nodeTotal      *prometheus.Desc
+	partitionAlloc *prometheus.Desc
+	partitionIdle  *prometheus.Desc
+	partitionTotal *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (gc *GRESCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- gc.alloc
+	ch <- gc.idle
+	ch <- gc.total
+	if gc.perNode {
+		ch <- gc.nodeAlloc
+		ch <- gc.nodeIdle
+		ch <- gc.nodeTotal
+	}
+	if gc.perPartition {
+		ch <- gc.partitionAlloc
+		ch <- gc.partitionIdle
+		ch <- gc.partitionTotal
+	}
+}
+
+func (gc *GRESCollector) Collect(ch chan<- prometheus.Metric) {
+	gcm := GRESGetMetrics(gc.names)
+	for key, gm := range gcm.cluster {
+		ch <- prometheus.MustNewConstMetric(gc.alloc, prometheus.GaugeValue, gm.alloc, key.name, key.gresType)
+		ch <- prometheus.MustNewConstMetric(gc.idle, prometheus.GaugeValue, gm.idle, key.name, key.gresType)
+		ch <- prometheus.MustNewConstMetric(gc.total, prometheus.GaugeValue, gm.total, key.name, key.gresType)
+	}
+	if gc.perNode {
+		for node := range gcm.nodes {
+			for key, gm := range gcm.nodes[node] {
+				ch <- prometheus.MustNewConstMetric(gc.nodeAlloc, prometheus.GaugeValue, gm.alloc, node, key.name, key.gresType)
+				ch <- prometheus.MustNewConstMetric(gc.nodeIdle, prometheus.GaugeValue, gm.idle, node, key.name, key.gresType)
+				ch <- prometheus.MustNewConstMetric(gc.nodeTotal, prometheus.GaugeValue, gm.total, node, key.name, key.gresType)
+			}
+		}
+	}
+	if gc.perPartition {
+		for partition := range gcm.partitions {
+			for key, gm := range gcm.partitions[partition] {
+				ch <- prometheus.MustNewConstMetric(gc.partitionAlloc, prometheus.GaugeValue, gm.alloc, partition, key.name, key.gresType)
+				ch <- prometheus.MustNewConstMetric(gc.partitionIdle, prometheus.GaugeValue, gm.idle, partition, key.name, key.gresType)
+				ch <- prometheus.MustNewConstMetric(gc.partitionTotal, prometheus.GaugeValue, gm.total, partition, key.name, key.gresType)
+			}
+		}
+	}
+}
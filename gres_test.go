@@ -0,0 +1,75 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseGRES(t *testing.T) {
+	gres := ParseGRES("gpu:a100:3(IDX:0,2-3),nvme:1,gpu:(null):0(IDX:N/A),bandwidth:lustre:4K")
+	assert.Equal(t, 3.0, gres[GRESKey{"gpu", "a100"}])
+	assert.Equal(t, 1.0, gres[GRESKey{"nvme", ""}])
+	assert.Equal(t, 0.0, gres[GRESKey{"gpu", ""}])
+	assert.Equal(t, 4096.0, gres[GRESKey{"bandwidth", "lustre"}])
+	assert.Empty(t, ParseGRES("(null)"))
+
+	// Flags and socket information after the count do not drop the entry
+	gres = ParseGRES("gpu:a100:4:no_consume,gpu:v100:2(S:0-1):no_consume,mps:no_consume:100,fpga")
+	assert.Equal(t, 4.0, gres[GRESKey{"gpu", "a100"}])
+	assert.Equal(t, 2.0, gres[GRESKey{"gpu", "v100"}])
+	assert.Equal(t, 100.0, gres[GRESKey{"mps", ""}])
+	assert.Equal(t, 1.0, gres[GRESKey{"fpga", ""}])
+}
+
+func TestGRESMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/sinfo_gres.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	metrics := ParseGRESMetrics(data, nil)
+	t.Logf("%+v", metrics)
+
+	// gpu01 is listed in two partitions but must be counted once
+	a100 := metrics.cluster[GRESKey{"gpu", "a100"}]
+	assert.Equal(t, 12.0, a100.total)
+	assert.Equal(t, 6.0, a100.alloc)
+	assert.Equal(t, 6.0, a100.idle)
+	assert.Equal(t, 7.0, metrics.cluster[GRESKey{"gpu", "1g.5gb"}].alloc)
+	assert.Equal(t, 48.0, metrics.cluster[GRESKey{"shard", "a100"}].idle)
+	assert.Equal(t, 2.0, metrics.cluster[GRESKey{"fpga", ""}].idle)
+	assert.Equal(t, 4.0, metrics.partitions["debug"][GRESKey{"gpu", "a100"}].total)
+	assert.Equal(t, 1.0, metrics.nodes["gpu01"][GRESKey{"nvme", ""}].idle)
+	assert.Empty(t, metrics.nodes["cn001"])
+
+	// The idle CPUs are taken from the CPU states
+	for _, ng := range ParseGRESNodes(data) {
+		switch ng.node {
+		case "cn001":
+			assert.Equal(t, 128.0, ng.cpusIdle)
+		case "gpu04":
+			assert.Equal(t, 0.0, ng.cpusIdle)
+		}
+	}
+
+	metrics = ParseGRESMetrics(data, []string{"nvme"})
+	assert.Len(t, metrics.cluster, 1)
+	assert.Equal(t, 6.0, metrics.cluster[GRESKey{"nvme", ""}].total)
+}
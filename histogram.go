@@ -0,0 +1,34 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+// HistogramBuckets sorts the values into cumulative histogram buckets
+func HistogramBuckets(values []float64, bounds []float64) (uint64, float64, map[float64]uint64) {
+	var sum float64
+	buckets := make(map[float64]uint64)
+	for _, bound := range bounds {
+		buckets[bound] = 0
+	}
+	for _, value := range values {
+		sum += value
+		for _, bound := range bounds {
+			if value <= bound {
+				buckets[bound]++
+			}
+		}
+	}
+	return uint64(len(values)), sum, buckets
+}
@@ -0,0 +1,32 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHistogramBuckets(t *testing.T) {
+	count, sum, buckets := HistogramBuckets([]float64{1, 4, 0}, gpuFragmentationBuckets)
+	assert.Equal(t, uint64(3), count)
+	assert.Equal(t, 5.0, sum)
+	assert.Equal(t, uint64(1), buckets[0])
+	assert.Equal(t, uint64(2), buckets[3])
+	assert.Equal(t, uint64(3), buckets[4])
+	assert.Equal(t, uint64(3), buckets[16])
+}
@@ -0,0 +1,263 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ScontrolJob stores the fields of a job printed by "scontrol show job -d",
+// the per node details (lines starting with "Nodes=") are kept separately
+type ScontrolJob struct {
+	fields map[string]string
+	nodes  []map[string]string
+}
+
+// JobGPU maps a GPU index on a node to the job it is allocated to
+type JobGPU struct {
+	node      string
+	index     string
+	jobid     string
+	user      string
+	account   string
+	partition string
+}
+
+// ScontrolJobsData executes the scontrol command to get the details of all jobs
+func ScontrolJobsData() []byte {
+	return Execute("scontrol", []string{"show", "job", "-d"})
+}
+
+// ParseScontrolFields splits a line of scontrol output into its key=value pairs
+func ParseScontrolFields(line string) map[string]string {
+	fields := make(map[string]string)
+	for _, token := range strings.Fields(line) {
+		kv := strings.SplitN(token, "=", 2)
+		if len(kv) == 2 {
+			fields[kv[0]] = kv[1]
+		}
+	}
+	return fields
+}
+
+// ExpandIndexList expands a list of indices like "0,2-3" into "0", "2", "3"
+func ExpandIndexList(list string) []string {
+	var indices []string
+	for _, item := range strings.Split(list, ",") {
+		bounds := strings.SplitN(item, "-", 2)
+		if len(bounds) == 1 {
+			if len(item) > 0 {
+				indices = append(indices, item)
+			}
+			continue
+		}
+		first, err1 := strconv.Atoi(bounds[0])
+		last, err2 := strconv.Atoi(bounds[1])
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for i := first; i <= last; i++ {
+			// Keep the zero padding of the range, e.g. "01-10"
+			indices = append(indices, fmt.Sprintf("%0*d", len(bounds[0]), i))
+		}
+	}
+	return indices
+}
+
+// ExpandHostlist expands a Slurm hostlist like "gpu[01-02,05],login1"
+// into the list of host names
+func ExpandHostlist(hostlist string) []string {
+	var hosts []string
+	depth := 0
+	start := 0
+	for i := 0; i <= len(hostlist); i++ {
+		if i < len(hostlist) {
+			switch hostlist[i] {
+			case '[':
+				depth++
+				continue
+			case ']':
+				depth--
+				continue
+			case ',':
+				if depth > 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		item := hostlist[start:i]
+		start = i + 1
+		if len(item) > 0 {
+			hosts = append(hosts, expandHost(item)...)
+		}
+	}
+	return hosts
+}
+
+// expandHost expands the ranges of a single host expression like "gpu[01-02]-ib"
+// or "rack[1-2]-node[01-02]" into the list of host names
+func expandHost(item string) []string {
+	open := strings.Index(item, "[")
+	if open < 0 {
+		return []string{item}
+	}
+	end := strings.Index(item[open:], "]")
+	if end < 0 {
+		return []string{item}
+	}
+	end += open
+	var hosts []string
+	for _, index := range ExpandIndexList(item[open+1 : end]) {
+		for _, suffix := range expandHost(item[end+1:]) {
+			hosts = append(hosts, item[:open]+index+suffix)
+		}
+	}
+	return hosts
+}
+
+// ParseScontrolJobs takes the output of "scontrol show job -d"
+// It returns one entry per job
+func ParseScontrolJobs(input []byte) []*ScontrolJob {
+	var jobs []*ScontrolJob
+	var job *ScontrolJob
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := ParseScontrolFields(line)
+		if _, ok := fields["JobId"]; ok {
+			job = &ScontrolJob{fields: make(map[string]string)}
+			jobs = append(jobs, job)
+			// The job name is the remainder of the line and may contain spaces
+			if i := strings.Index(line, "JobName="); i >= 0 {
+				job.fields["JobName"] = line[i+len("JobName="):]
+			}
+		}
+		if job == nil || len(fields) == 0 {
+			continue
+		}
+		if _, ok := fields["Nodes"]; ok {
+			job.nodes = append(job.nodes, fields)
+			continue
+		}
+		for key, value := range fields {
+			if _, ok := job.fields[key]; !ok {
+				job.fields[key] = value
+			}
+		}
+	}
+	return jobs
+}
+
+// PendingJobShares returns the number of jobs an entry of "scontrol show job" stands
+// for and the partitions it is accounted for in. The pending tasks of a job array are
+// listed once, e.g. "ArrayTaskId=1-100%10", and jobs submitted to multiple partitions
+// are accounted for in every one of them.
+func PendingJobShares(job *ScontrolJob) (float64, []string) {
+	jobs := 1.0
+	if tasks, ok := job.fields["ArrayTaskId"]; ok {
+		jobs, _ = ParseArrayTasks(tasks)
+	}
+	return jobs, strings.Split(job.fields["Partition"], ",")
+}
+
+// ScontrolUser strips the numerical user ID from a field like "alice(1001)"
+func ScontrolUser(user string) string {
+	return strings.Split(user, "(")[0]
+}
+
+// ParseGPUIndices extracts the GPU indices from the GRES of a node allocation,
+// e.g. "gpu:a100:2(IDX:0,3)" or "gpu(IDX:0-1)" for older Slurm versions
+func ParseGPUIndices(gres string) []string {
+	var indices []string
+	for _, item := range SplitGRES(gres) {
+		if strings.Split(item, ":")[0] != "gpu" && !strings.HasPrefix(item, "gpu(") {
+			continue
+		}
+		open := strings.Index(item, "(IDX:")
+		if open < 0 || !strings.HasSuffix(item, ")") {
+			continue
+		}
+		indices = append(indices, ExpandIndexList(item[open+5:len(item)-1])...)
+	}
+	return indices
+}
+
+// ParseJobGPUs takes the output of "scontrol show job -d"
+// It returns the GPU indices allocated to every running job
+func ParseJobGPUs(input []byte) []JobGPU {
+	var gpus []JobGPU
+	for _, job := range ParseScontrolJobs(input) {
+		if job.fields["JobState"] != "RUNNING" {
+			continue
+		}
+		for _, detail := range job.nodes {
+			gres, ok := detail["GRES"]
+			if !ok {
+				gres = detail["GRES_IDX"]
+			}
+			indices := ParseGPUIndices(gres)
+			for _, node := range ExpandHostlist(detail["Nodes"]) {
+				for _, index := range indices {
+					gpus = append(gpus, JobGPU{
+						node:      node,
+						index:     index,
+						jobid:     job.fields["JobId"],
+						user:      ScontrolUser(job.fields["UserId"]),
+						account:   job.fields["Account"],
+						partition: job.fields["Partition"],
+					})
+				}
+			}
+		}
+	}
+	return gpus
+}
+
+func JobGPUsGetMetrics() []JobGPU {
+	return ParseJobGPUs(ScontrolJobsData())
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm job GPU allocations into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+func NewJobGPUsCollector() *JobGPUsCollector {
+	labels := []string{"node", "gpu_index", "jobid", "user", "account", "partition"}
+	return &JobGPUsCollector{
+		info: prometheus.NewDesc("slurm_job_gpu_info", "GPU allocated to a running job, identified by node and GPU index", labels, nil),
+	}
+}
+
+type JobGPUsCollector struct {
+	info *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (jc *JobGPUsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jc.info
+}
+
+func (jc *JobGPUsCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, gpu := range JobGPUsGetMetrics() {
+		ch <- prometheus.MustNewConstMetric(jc.info, prometheus.GaugeValue, 1, gpu.node, gpu.index, gpu.jobid, gpu.user, gpu.account, gpu.partition)
+	}
+}
@@ -0,0 +1,55 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandHostlist(t *testing.T) {
+	assert.Equal(t, []string{"gpu01", "gpu02", "gpu05", "login1"}, ExpandHostlist("gpu[01-02,05],login1"))
+	assert.Equal(t, []string{"a048"}, ExpandHostlist("a048"))
+	assert.Equal(t, []string{"gpu01-ib", "gpu02-ib", "login1"}, ExpandHostlist("gpu[01-02]-ib,login1"))
+	assert.Equal(t, []string{"r1n01", "r1n02", "r2n01", "r2n02"}, ExpandHostlist("r[1-2]n[01-02]"))
+	assert.Empty(t, ExpandHostlist(""))
+}
+
+func TestJobGPUsMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/scontrol_job.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	gpus := ParseJobGPUs(data)
+	t.Logf("%+v", gpus)
+
+	assert.Len(t, gpus, 5)
+	assert.Contains(t, gpus, JobGPU{"gpu01", "0", "4242", "alice", "vision", "gpu"})
+	assert.Contains(t, gpus, JobGPU{"gpu02", "2", "4242", "alice", "vision", "gpu"})
+	assert.Contains(t, gpus, JobGPU{"gpu03", "3", "4243", "bob", "chemistry", "gpu"})
+}
+
+func TestPendingJobShares(t *testing.T) {
+	jobs, partitions := PendingJobShares(&ScontrolJob{fields: map[string]string{"ArrayTaskId": "1-100%10", "Partition": "gpu,gpu-long"}})
+	assert.Equal(t, 100.0, jobs)
+	assert.Equal(t, []string{"gpu", "gpu-long"}, partitions)
+	jobs, partitions = PendingJobShares(&ScontrolJob{fields: map[string]string{"Partition": "batch"}})
+	assert.Equal(t, 1.0, jobs)
+	assert.Equal(t, []string{"batch"}, partitions)
+}
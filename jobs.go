@@ -0,0 +1,171 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// JobInfo stores the resources and times of a single job
+type JobInfo struct {
+	jobid     string
+	user      string
+	account   string
+	partition string
+	qos       string
+	name      string
+	state     string
+	cpus      float64
+	mem       float64
+	nodes     float64
+	gpus      float64
+	elapsed   float64
+	// Negative for jobs without time limit
+	timeLimit float64
+}
+
+// Number of series exported for every job
+const jobSeries = 6
+
+// Parse a count like "4", or the lower bound of a range like "1-2" requested by pending jobs
+func parseJobCount(field string) float64 {
+	value, _ := strconv.ParseFloat(strings.Split(field, "-")[0], 64)
+	return value
+}
+
+// ParseJobsMetrics takes the output of "scontrol show job -d"
+// It returns the running jobs, and the pending jobs if requested
+func ParseJobsMetrics(input []byte, pending bool) []*JobInfo {
+	var jobs []*JobInfo
+	for _, job := range ParseScontrolJobs(input) {
+		state := job.fields["JobState"]
+		if state != "RUNNING" && !(pending && state == "PENDING") {
+			continue
+		}
+		// Depending on the Slurm version the allocated resources are
+		// printed as AllocTRES or TRES, the requested ones as ReqTRES
+		key := "AllocTRES"
+		if state == "PENDING" {
+			key = "ReqTRES"
+		}
+		tres, ok := job.fields[key]
+		if !ok {
+			tres = job.fields["TRES"]
+		}
+		resources := ParseTRES(tres)
+		ji := JobInfo{
+			jobid:     job.fields["JobId"],
+			user:      ScontrolUser(job.fields["UserId"]),
+			account:   job.fields["Account"],
+			partition: job.fields["Partition"],
+			qos:       job.fields["QOS"],
+			name:      job.fields["JobName"],
+			state:     strings.ToLower(state),
+			cpus:      parseJobCount(job.fields["NumCPUs"]),
+			mem:       resources["mem"],
+			nodes:     parseJobCount(job.fields["NumNodes"]),
+			gpus:      resources["gres/gpu"],
+			timeLimit: -1,
+		}
+		ji.elapsed, _ = ParseSlurmDuration(job.fields["RunTime"])
+		if limit, err := ParseSlurmDuration(job.fields["TimeLimit"]); err == nil {
+			ji.timeLimit = limit
+		}
+		jobs = append(jobs, &ji)
+	}
+	return jobs
+}
+
+// LimitJobs keeps the largest jobs (by CPUs) which fit into maxSeries
+// It returns the jobs to export and the number of jobs left out
+func LimitJobs(jobs []*JobInfo, maxSeries int) ([]*JobInfo, int) {
+	maxJobs := maxSeries / jobSeries
+	if maxSeries <= 0 || len(jobs) <= maxJobs {
+		return jobs, 0
+	}
+	sort.SliceStable(jobs, func(i, j int) bool { return jobs[i].cpus > jobs[j].cpus })
+	return jobs[:maxJobs], len(jobs) - maxJobs
+}
+
+func JobsGetMetrics(pending bool) []*JobInfo {
+	return ParseJobsMetrics(ScontrolJobsData(), pending)
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * metrics of the individual Slurm jobs into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// NewJobsCollector returns a collector for the running jobs, and the pending jobs
+// if requested, exporting at most maxSeries series unless it is zero
+func NewJobsCollector(pending bool, maxSeries int) *JobsCollector {
+	labels := []string{"jobid", "user", "account", "partition", "qos", "job_name", "state"}
+	return &JobsCollector{
+		pending:   pending,
+		maxSeries: maxSeries,
+		cpus:      prometheus.NewDesc("slurm_job_cpus", "CPUs allocated to the job", labels, nil),
+		mem:       prometheus.NewDesc("slurm_job_mem", "Memory allocated to the job in megabytes", labels, nil),
+		nodes:     prometheus.NewDesc("slurm_job_nodes", "Nodes allocated to the job", labels, nil),
+		gpus:      prometheus.NewDesc("slurm_job_gpus", "GPUs allocated to the job", labels, nil),
+		elapsed:   prometheus.NewDesc("slurm_job_elapsed_seconds", "Time elapsed since the start of the job", labels, nil),
+		timeLimit: prometheus.NewDesc("slurm_job_time_limit_seconds", "Time limit of the job", labels, nil),
+		dropped:   prometheus.NewDesc("slurm_job_metrics_dropped", "Jobs left out because of the limit of exported series", nil, nil),
+	}
+}
+
+type JobsCollector struct {
+	pending   bool
+	maxSeries int
+	cpus      *prometheus.Desc
+	mem       *prometheus.Desc
+	nodes     *prometheus.Desc
+	gpus      *prometheus.Desc
+	elapsed   *prometheus.Desc
+	timeLimit *prometheus.Desc
+	dropped   *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (jc *JobsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jc.cpus
+	ch <- jc.mem
+	ch <- jc.nodes
+	ch <- jc.gpus
+	ch <- jc.elapsed
+	ch <- jc.timeLimit
+	ch <- jc.dropped
+}
+
+func (jc *JobsCollector) Collect(ch chan<- prometheus.Metric) {
+	jobs, dropped := LimitJobs(JobsGetMetrics(jc.pending), jc.maxSeries)
+	for _, j := range jobs {
+		labels := []string{j.jobid, j.user, j.account, j.partition, j.qos, j.name, j.state}
+		ch <- prometheus.MustNewConstMetric(jc.cpus, prometheus.GaugeValue, j.cpus, labels...)
+		ch <- prometheus.MustNewConstMetric(jc.mem, prometheus.GaugeValue, j.mem, labels...)
+		ch <- prometheus.MustNewConstMetric(jc.nodes, prometheus.GaugeValue, j.nodes, labels...)
+		ch <- prometheus.MustNewConstMetric(jc.gpus, prometheus.GaugeValue, j.gpus, labels...)
+		ch <- prometheus.MustNewConstMetric(jc.elapsed, prometheus.GaugeValue, j.elapsed, labels...)
+		if j.timeLimit >= 0 {
+			ch <- prometheus.MustNewConstMetric(jc.timeLimit, prometheus.GaugeValue, j.timeLimit, labels...)
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(jc.dropped, prometheus.GaugeValue, float64(dropped))
+}
@@ -0,0 +1,61 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobsMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/scontrol_job.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	jobs := ParseJobsMetrics(data, false)
+	t.Logf("%+v", jobs)
+
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, JobInfo{
+		jobid:     "4242",
+		user:      "alice",
+		account:   "vision",
+		partition: "gpu",
+		qos:       "normal",
+		name:      "train resnet",
+		state:     "running",
+		cpus:      16,
+		mem:       128000,
+		nodes:     2,
+		gpus:      4,
+		elapsed:   3723,
+		timeLimit: 86400,
+	}, *jobs[0])
+
+	jobs = ParseJobsMetrics(data, true)
+	assert.Len(t, jobs, 3)
+	assert.Equal(t, "pending", jobs[2].state)
+	assert.Equal(t, 32768.0, jobs[2].mem)
+
+	// Only the largest job fits into the limit of series
+	limited, dropped := LimitJobs(jobs, 2*jobSeries-1)
+	assert.Len(t, limited, 1)
+	assert.Equal(t, "4242", limited[0].jobid)
+	assert.Equal(t, 2, dropped)
+}
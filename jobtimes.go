@@ -0,0 +1,220 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Upper bounds (in seconds) of the histograms of job durations, from one minute to 30 days
+var jobTimesBuckets = []float64{60, 300, 900, 1800, 3600, 7200, 14400, 28800, 43200, 86400, 172800, 345600, 604800, 1209600, 2592000}
+
+// Quantiles of the summaries of job durations
+var jobTimesQuantiles = []float64{0.5, 0.9, 0.99}
+
+// JobTimesMetrics stores the durations (in seconds) of the jobs in a partition
+type JobTimesMetrics struct {
+	pendingWait      []float64
+	pendingStart     []float64
+	runningElapsed   []float64
+	runningTimeLimit []float64
+	runningRemaining []float64
+	// Latest end time of the running jobs as Unix timestamp
+	runningLatestEnd float64
+}
+
+// Execute the squeue command to get the submit time, start time and time limit
+// of all pending and running jobs
+func JobTimesData() []byte {
+	args := []string{"-a", "-r", "-h", "--states=PENDING,RUNNING", "-o", "%P|%T|%V|%S|%l"}
+	return Execute("squeue", args)
+}
+
+// ParseSlurmDuration converts a duration printed by a Slurm command into seconds,
+// accepted formats are "minutes", "minutes:seconds", "hours:minutes:seconds",
+// "days-hours", "days-hours:minutes" and "days-hours:minutes:seconds", the
+// seconds may have a fractional part. It fails for values like "UNLIMITED".
+func ParseSlurmDuration(field string) (float64, error) {
+	field = strings.TrimSpace(field)
+	var days float64
+	// Multipliers of the colon separated fields, depending on the presence of days
+	multipliers := [][]float64{nil, {60}, {60, 1}, {3600, 60, 1}}
+	if i := strings.Index(field, "-"); i >= 0 {
+		var err error
+		if days, err = strconv.ParseFloat(field[:i], 64); err != nil {
+			return 0, err
+		}
+		field = field[i+1:]
+		multipliers = [][]float64{nil, {3600}, {3600, 60}, {3600, 60, 1}}
+	}
+	parts := strings.Split(field, ":")
+	if len(parts) >= len(multipliers) {
+		return 0, errors.New("invalid duration: " + field)
+	}
+	seconds := days * 86400
+	for i, part := range parts {
+		value, err := strconv.ParseFloat(part, 64)
+		if err != nil {
+			return 0, err
+		}
+		seconds += value * multipliers[len(parts)][i]
+	}
+	return seconds, nil
+}
+
+// ParseJobTimesMetrics takes the output of squeue and returns the durations of
+// the jobs per partition relative to now. Pending jobs submitted to multiple
+// partitions are accounted for in every one of them.
+func ParseJobTimesMetrics(input []byte, now time.Time) map[string]*JobTimesMetrics {
+	partitions := make(map[string]*JobTimesMetrics)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 5 {
+			continue
+		}
+		for _, partition := range strings.Split(fields[0], ",") {
+			if _, ok := partitions[partition]; !ok {
+				partitions[partition] = &JobTimesMetrics{}
+			}
+			jm := partitions[partition]
+			switch fields[1] {
+			case "PENDING":
+				if submit, err := ParseSlurmTime(fields[2]); err == nil {
+					jm.pendingWait = append(jm.pendingWait, math.Max(now.Sub(submit).Seconds(), 0))
+				}
+				// The start time of pending jobs is the one expected by the
+				// backfill scheduler (as listed by "squeue --start"), if any
+				if start, err := ParseSlurmTime(fields[3]); err == nil {
+					jm.pendingStart = append(jm.pendingStart, math.Max(start.Sub(now).Seconds(), 0))
+				}
+			case "RUNNING":
+				start, err := ParseSlurmTime(fields[3])
+				if err != nil {
+					continue
+				}
+				elapsed := math.Max(now.Sub(start).Seconds(), 0)
+				jm.runningElapsed = append(jm.runningElapsed, elapsed)
+				// Jobs without time limit are not taken into account for the end time
+				limit, err := ParseSlurmDuration(fields[4])
+				if err != nil {
+					continue
+				}
+				jm.runningTimeLimit = append(jm.runningTimeLimit, limit)
+				jm.runningRemaining = append(jm.runningRemaining, math.Max(limit-elapsed, 0))
+				end := float64(start.Unix()) + limit
+				if end > jm.runningLatestEnd {
+					jm.runningLatestEnd = end
+				}
+			}
+		}
+	}
+	return partitions
+}
+
+// Quantiles computes the given quantiles of the values with the nearest-rank method
+func Quantiles(values []float64, quantiles []float64) map[float64]float64 {
+	result := make(map[float64]float64)
+	if len(values) == 0 {
+		return result
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	for _, q := range quantiles {
+		rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+		if rank < 0 {
+			rank = 0
+		}
+		result[q] = sorted[rank]
+	}
+	return result
+}
+
+func JobTimesGetMetrics() map[string]*JobTimesMetrics {
+	return ParseJobTimesMetrics(JobTimesData(), time.Now())
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * durations of the Slurm jobs into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+func NewJobTimesCollector() *JobTimesCollector {
+	labels := []string{"partition"}
+	return &JobTimesCollector{
+		pendingWait:        prometheus.NewDesc("slurm_queue_pending_wait_seconds", "Time pending jobs are waiting in the queue since their submission", labels, nil),
+		pendingWaitSummary: prometheus.NewDesc("slurm_queue_pending_wait_summary_seconds", "Quantiles of the time pending jobs are waiting in the queue since their submission", labels, nil),
+		pendingStart:       prometheus.NewDesc("slurm_queue_pending_scheduled_start_seconds", "Time until the start of pending jobs expected by the scheduler", labels, nil),
+		runningElapsed:     prometheus.NewDesc("slurm_queue_running_elapsed_seconds", "Time elapsed since the start of running jobs", labels, nil),
+		runningTimeLimit:   prometheus.NewDesc("slurm_queue_running_time_limit_seconds", "Time limit of running jobs", labels, nil),
+		runningRemaining:   prometheus.NewDesc("slurm_queue_running_remaining_seconds", "Time remaining until running jobs reach their time limit", labels, nil),
+		runningLatestEnd:   prometheus.NewDesc("slurm_queue_running_latest_end_time_seconds", "Latest end time of running jobs according to their time limit as Unix timestamp", labels, nil),
+	}
+}
+
+type JobTimesCollector struct {
+	pendingWait        *prometheus.Desc
+	pendingWaitSummary *prometheus.Desc
+	pendingStart       *prometheus.Desc
+	runningElapsed     *prometheus.Desc
+	runningTimeLimit   *prometheus.Desc
+	runningRemaining   *prometheus.Desc
+	runningLatestEnd   *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (jc *JobTimesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- jc.pendingWait
+	ch <- jc.pendingWaitSummary
+	ch <- jc.pendingStart
+	ch <- jc.runningElapsed
+	ch <- jc.runningTimeLimit
+	ch <- jc.runningRemaining
+	ch <- jc.runningLatestEnd
+}
+
+func (jc *JobTimesCollector) Collect(ch chan<- prometheus.Metric) {
+	jm := JobTimesGetMetrics()
+	for p := range jm {
+		if len(jm[p].pendingWait) > 0 {
+			count, sum, buckets := HistogramBuckets(jm[p].pendingWait, jobTimesBuckets)
+			ch <- prometheus.MustNewConstHistogram(jc.pendingWait, count, sum, buckets, p)
+			ch <- prometheus.MustNewConstSummary(jc.pendingWaitSummary, count, sum, Quantiles(jm[p].pendingWait, jobTimesQuantiles), p)
+		}
+		if len(jm[p].pendingStart) > 0 {
+			count, sum, buckets := HistogramBuckets(jm[p].pendingStart, jobTimesBuckets)
+			ch <- prometheus.MustNewConstHistogram(jc.pendingStart, count, sum, buckets, p)
+		}
+		if len(jm[p].runningElapsed) > 0 {
+			count, sum, buckets := HistogramBuckets(jm[p].runningElapsed, jobTimesBuckets)
+			ch <- prometheus.MustNewConstHistogram(jc.runningElapsed, count, sum, buckets, p)
+		}
+		if len(jm[p].runningTimeLimit) > 0 {
+			count, sum, buckets := HistogramBuckets(jm[p].runningTimeLimit, jobTimesBuckets)
+			ch <- prometheus.MustNewConstHistogram(jc.runningTimeLimit, count, sum, buckets, p)
+			count, sum, buckets = HistogramBuckets(jm[p].runningRemaining, jobTimesBuckets)
+			ch <- prometheus.MustNewConstHistogram(jc.runningRemaining, count, sum, buckets, p)
+			ch <- prometheus.MustNewConstMetric(jc.runningLatestEnd, prometheus.GaugeValue, jm[p].runningLatestEnd, p)
+		}
+	}
+}
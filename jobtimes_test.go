@@ -0,0 +1,78 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobTimesMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/squeue_times.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	now := time.Date(2021, 3, 4, 12, 0, 0, 0, time.Local)
+	jm := ParseJobTimesMetrics(data, now)
+	t.Logf("%+v", jm)
+
+	assert.Equal(t, []float64{60, 1800, 10800}, jm["batch"].pendingWait)
+	assert.Equal(t, []float64{86400, 7200, 7200}, jm["gpu"].pendingWait)
+	assert.Equal(t, []float64{86400}, jm["gpu-long"].pendingWait)
+
+	// Expected start times in the past are due now
+	assert.Equal(t, []float64{7200}, jm["batch"].pendingStart)
+	// A job without submit time is still accounted for in the expected start time
+	assert.Equal(t, []float64{3600, 172800, 0}, jm["gpu"].pendingStart)
+	assert.Empty(t, jm["gpu-long"].pendingStart)
+
+	quantiles := Quantiles(jm["batch"].pendingWait, jobTimesQuantiles)
+	assert.Equal(t, 1800.0, quantiles[0.5])
+	assert.Equal(t, 10800.0, quantiles[0.99])
+
+	// The job without time limit is only accounted for in the elapsed time
+	assert.Equal(t, []float64{7200, 1800, 273600}, jm["batch"].runningElapsed)
+	assert.Equal(t, []float64{14400, 86400}, jm["batch"].runningTimeLimit)
+	assert.Equal(t, []float64{7200, 84600}, jm["batch"].runningRemaining)
+	end := time.Date(2021, 3, 5, 11, 30, 0, 0, time.Local)
+	assert.Equal(t, float64(end.Unix()), jm["batch"].runningLatestEnd)
+	// The job exceeded its time limit
+	assert.Equal(t, []float64{0}, jm["gpu"].runningRemaining)
+}
+
+func TestParseSlurmDuration(t *testing.T) {
+	for input, expected := range map[string]float64{
+		"30":         1800,
+		"30:15":      1815,
+		"2:00:00":    7200,
+		"1-00:00:00": 86400,
+		"2-12":       216000,
+		"1-01:30":    91800,
+		"01:02.500":  62.5,
+	} {
+		seconds, err := ParseSlurmDuration(input)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, seconds, input)
+	}
+	_, err := ParseSlurmDuration("UNLIMITED")
+	assert.Error(t, err)
+	_, err = ParseSlurmDuration("1:2:3:4")
+	assert.Error(t, err)
+}
@@ -0,0 +1,156 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// LicenseMetrics stores the counts of a license, "Reserved" is not printed by
+// older Slurm versions
+type LicenseMetrics struct {
+	total       float64
+	used        float64
+	free        float64
+	reserved    float64
+	hasReserved bool
+}
+
+type LicensesMetrics struct {
+	licenses map[string]*LicenseMetrics
+	// Pending jobs with the reason "Licenses" per requested license
+	blocked map[string]float64
+}
+
+// Execute the scontrol command to get all licenses, one per line
+func LicensesData() []byte {
+	return Execute("scontrol", []string{"show", "licenses", "-o"})
+}
+
+// Execute the squeue command to get the licenses requested by pending jobs
+func PendingLicensesData() []byte {
+	return Execute("squeue", []string{"-a", "-r", "-h", "--states=PENDING", "-o", "%W|%r"})
+}
+
+// ParseLicenses takes the output of "scontrol show licenses -o"
+// It returns the counts of every license
+func ParseLicenses(input []byte) map[string]*LicenseMetrics {
+	licenses := make(map[string]*LicenseMetrics)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := ParseScontrolFields(line)
+		name, ok := fields["LicenseName"]
+		if !ok {
+			continue
+		}
+		lm := LicenseMetrics{}
+		lm.total, _ = strconv.ParseFloat(fields["Total"], 64)
+		lm.used, _ = strconv.ParseFloat(fields["Used"], 64)
+		lm.free, _ = strconv.ParseFloat(fields["Free"], 64)
+		if reserved, ok := fields["Reserved"]; ok {
+			lm.reserved, _ = strconv.ParseFloat(reserved, 64)
+			lm.hasReserved = true
+		}
+		licenses[name] = &lm
+	}
+	return licenses
+}
+
+// ParsePendingLicenses takes the output of squeue with the licenses requested by
+// pending jobs like "matlab:2,abaqus*5" and counts the jobs blocked on every license
+// A job is only counted for the licenses with less free licenses than it requests
+func ParsePendingLicenses(input []byte, licenses map[string]*LicenseMetrics) map[string]float64 {
+	blocked := make(map[string]float64)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 2 || strings.TrimSpace(fields[1]) != "Licenses" {
+			continue
+		}
+		for _, item := range strings.Split(fields[0], ",") {
+			request := strings.FieldsFunc(item, func(r rune) bool { return r == ':' || r == '*' })
+			if len(request) == 0 || request[0] == "(null)" {
+				continue
+			}
+			count := 1.0
+			if len(request) > 1 {
+				count, _ = strconv.ParseFloat(request[1], 64)
+			}
+			if lm, ok := licenses[request[0]]; ok && count <= lm.free {
+				continue
+			}
+			blocked[request[0]]++
+		}
+	}
+	return blocked
+}
+
+func LicensesGetMetrics() *LicensesMetrics {
+	licenses := ParseLicenses(LicensesData())
+	return &LicensesMetrics{
+		licenses: licenses,
+		blocked:  ParsePendingLicenses(PendingLicensesData(), licenses),
+	}
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm license metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+func NewLicensesCollector() *LicensesCollector {
+	labels := []string{"license"}
+	return &LicensesCollector{
+		total:    prometheus.NewDesc("slurm_license_total", "Total licenses", labels, nil),
+		used:     prometheus.NewDesc("slurm_license_used", "Licenses in use", labels, nil),
+		free:     prometheus.NewDesc("slurm_license_free", "Free licenses", labels, nil),
+		reserved: prometheus.NewDesc("slurm_license_reserved", "Licenses reserved by reservations", labels, nil),
+		blocked:  prometheus.NewDesc("slurm_license_pending_jobs", "Pending jobs waiting for the license", labels, nil),
+	}
+}
+
+type LicensesCollector struct {
+	total    *prometheus.Desc
+	used     *prometheus.Desc
+	free     *prometheus.Desc
+	reserved *prometheus.Desc
+	blocked  *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (lc *LicensesCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- lc.total
+	ch <- lc.used
+	ch <- lc.free
+	ch <- lc.reserved
+	ch <- lc.blocked
+}
+
+func (lc *LicensesCollector) Collect(ch chan<- prometheus.Metric) {
+	lm := LicensesGetMetrics()
+	for name, license := range lm.licenses {
+		ch <- prometheus.MustNewConstMetric(lc.total, prometheus.GaugeValue, license.total, name)
+		ch <- prometheus.MustNewConstMetric(lc.used, prometheus.GaugeValue, license.used, name)
+		ch <- prometheus.MustNewConstMetric(lc.free, prometheus.GaugeValue, license.free, name)
+		if license.hasReserved {
+			ch <- prometheus.MustNewConstMetric(lc.reserved, prometheus.GaugeValue, license.reserved, name)
+		}
+		// Licenses without blocked jobs are exported as well to be able to alert on them
+		ch <- prometheus.MustNewConstMetric(lc.blocked, prometheus.GaugeValue, lm.blocked[name], name)
+	}
+}
@@ -0,0 +1,55 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLicenses(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/scontrol_licenses.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	licenses := ParseLicenses(data)
+	t.Logf("%+v", licenses)
+
+	assert.Len(t, licenses, 3)
+	assert.Equal(t, &LicenseMetrics{total: 50, used: 50, free: 0, reserved: 10, hasReserved: true}, licenses["matlab"])
+	assert.Equal(t, &LicenseMetrics{total: 200, used: 120, free: 80, hasReserved: true}, licenses["abaqus@flex"])
+	assert.Equal(t, &LicenseMetrics{total: 10, free: 10}, licenses["scratch"])
+}
+
+func TestPendingLicenses(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/squeue_licenses.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	licenses := map[string]*LicenseMetrics{
+		"matlab":      {total: 50, used: 50},
+		"abaqus@flex": {total: 200, used: 120, free: 80},
+	}
+	blocked := ParsePendingLicenses(data, licenses)
+	t.Logf("%+v", blocked)
+
+	// Jobs requesting less abaqus@flex licenses than free are blocked on matlab only
+	assert.Equal(t, map[string]float64{"matlab": 3, "abaqus@flex": 1}, blocked)
+}
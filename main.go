@@ -21,6 +21,9 @@ import (
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/log"
 	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 func init() {
@@ -29,8 +32,6 @@ func init() {
 	prometheus.MustRegister(NewCPUsCollector())           // from cpus.go
 	prometheus.MustRegister(NewNodesCollector())          // from nodes.go
 	prometheus.MustRegister(NewNodeCollector())           // from node.go
-	prometheus.MustRegister(NewPartitionsCollector())     // from partitions.go
-	prometheus.MustRegister(NewQueueCollector())          // from queue.go
 	prometheus.MustRegister(NewSchedulerCollector())      // from scheduler.go
 	prometheus.MustRegister(NewFairShareCollector())      // from sshare.go
 	prometheus.MustRegister(NewUsersCollector())          // from users.go
@@ -46,18 +47,239 @@ var gpuAcct = flag.Bool(
 	false,
 	"Enable GPUs accounting")
 
+var gresAcct = flag.Bool(
+	"gres-acct",
+	false,
+	"Enable accounting of generic resources (GRES)")
+
+var gresNames = flag.String(
+	"gres-names",
+	"",
+	"Comma separated list of GRES names to account for, all GRES if empty")
+
+var gresPerNode = flag.Bool(
+	"gres-per-node",
+	false,
+	"Export generic resources per node")
+
+var gresPerPartition = flag.Bool(
+	"gres-per-partition",
+	false,
+	"Export generic resources per partition")
+
+var jobGPUInfo = flag.Bool(
+	"job-gpu-info",
+	false,
+	"Export the GPU indices allocated to every running job")
+
+var tresUsage = flag.Bool(
+	"tres-usage",
+	false,
+	"Enable TRES usage accounting of finished jobs per account and user (the counters are kept for every account, user and partition seen since the start)")
+
+var jobsFinished = flag.Bool(
+	"jobs-finished",
+	false,
+	"Enable the counters of finished jobs per state, partition and account (the counters are kept for every account and partition seen since the start)")
+
+var jobsEfficiency = flag.Bool(
+	"jobs-efficiency",
+	false,
+	"Enable the efficiency of finished jobs per account, user and partition (the histograms are kept for every account, user and partition seen since the start)")
+
+var partitionDemand = flag.Bool(
+	"partition-demand",
+	false,
+	"Enable the resources requested by pending jobs per partition")
+
+var partitionDemandPerAccount = flag.Bool(
+	"partition-demand-per-account",
+	false,
+	"Export the resources requested by pending jobs per partition and account (implies -partition-demand)")
+
+var workloadRulesFile = flag.String(
+	"workload-rules",
+	"",
+	"File with the rules to classify the running jobs into workloads, no classification if empty")
+
+var sacctSettleTime = flag.Duration(
+	"sacct-settle-time",
+	time.Minute,
+	"Time given to SlurmDBD to record finished jobs before they are queried, jobs recorded later are not counted")
+
+var stateDir = flag.String(
+	"state-dir",
+	"",
+	"Directory to persist the state of the accounting collectors, not persisted if empty")
+
+var jobsInfo = flag.Bool(
+	"jobs",
+	false,
+	"Enable metrics for every running job")
+
+var jobsPending = flag.Bool(
+	"jobs-pending",
+	false,
+	"Include pending jobs in the metrics for every job")
+
+var jobsMaxSeries = flag.Int(
+	"jobs-max-series",
+	10000,
+	"Maximum number of series exported by the metrics for every job, the largest jobs are kept (0 for no limit)")
+
+var priorityInfo = flag.Bool(
+	"priority",
+	false,
+	"Enable the priority metrics of pending jobs (requires the multifactor priority plugin)")
+
+var qosInfo = flag.Bool(
+	"qos",
+	false,
+	"Enable the metrics per QOS (requires the accounting database)")
+
+// Returns the path of a file in the state directory, or an empty path if not configured
+func statePath(name string) string {
+	if len(*stateDir) == 0 {
+		return ""
+	}
+	return filepath.Join(*stateDir, name)
+}
+
+var arraysInfo = flag.Bool(
+	"arrays",
+	false,
+	"Enable the metrics of job arrays")
+
+var dependenciesInfo = flag.Bool(
+	"dependencies",
+	false,
+	"Enable the dependency metrics of pending jobs")
+
+var jobTimesInfo = flag.Bool(
+	"job-times",
+	false,
+	"Enable the wait time of pending jobs and the run time of running jobs")
+
+var licensesInfo = flag.Bool(
+	"licenses",
+	false,
+	"Enable the license metrics")
+
+var reservationsInfo = flag.Bool(
+	"reservations",
+	false,
+	"Enable the metrics of advanced reservations")
+
+var pendingReasonCategories = flag.Bool(
+	"pending-reason-categories",
+	false,
+	"Export the reasons of pending jobs additionally grouped into categories")
+
+// Split a comma separated command line option into a list
+func splitOption(option string) []string {
+	var list []string
+	for _, item := range strings.Split(option, ",") {
+		if item = strings.TrimSpace(item); len(item) > 0 {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
 func main() {
 	flag.Parse()
 
+	workloadRules, err := LoadWorkloadRules(*workloadRulesFile)
+	if err != nil {
+		log.Fatalf("Can not load workload rules: %v", err)
+	}
+
+	// Collectors configured by command line options are registered once these are parsed,
+	// the demand per account implies the demand of pending jobs per partition
+	demand := *partitionDemand || *partitionDemandPerAccount
+	prometheus.MustRegister(NewQueueCollector(*pendingReasonCategories))                // from queue.go
+	prometheus.MustRegister(NewPartitionsCollector(demand, *partitionDemandPerAccount)) // from partitions.go
+
+	// Turn on the classification into workloads only if a rules file is given.
+	if workloadRules != nil {
+		prometheus.MustRegister(NewWorkloadCollector(workloadRules)) // from workload.go
+	}
+
 	// Turn on GPUs accounting only if the corresponding command line option is set to true.
 	if *gpuAcct {
 		prometheus.MustRegister(NewGPUsCollector())   // from gpus.go
 	}
 
+	// Turn on GRES accounting only if the corresponding command line option is set to true.
+	if *gresAcct {
+		prometheus.MustRegister(NewGRESCollector(splitOption(*gresNames), *gresPerNode, *gresPerPartition)) // from gres.go
+	}
+
+	// Map the GPUs to running jobs only if the corresponding command line option is set to true.
+	if *jobGPUInfo {
+		prometheus.MustRegister(NewJobGPUsCollector()) // from jobgpus.go
+	}
+
+	// Turn on TRES usage accounting only if the corresponding command line option is set to true.
+	if *tresUsage {
+		prometheus.MustRegister(NewUsageCollector(statePath("tres_usage.cursor"), *sacctSettleTime)) // from usage.go
+	}
+
+	// Turn on the counters of finished jobs only if the corresponding command line option is set to true.
+	if *jobsFinished {
+		prometheus.MustRegister(NewFinishedCollector(statePath("jobs_finished.cursor"), *sacctSettleTime)) // from finished.go
+	}
+
+	// Turn on the efficiency of finished jobs only if the corresponding command line option is set to true.
+	if *jobsEfficiency {
+		prometheus.MustRegister(NewEfficiencyCollector(statePath("jobs_efficiency.cursor"), *sacctSettleTime)) // from efficiency.go
+	}
+
+	// Turn on the metrics for every job only if the corresponding command line option is set to true.
+	if *jobsInfo {
+		prometheus.MustRegister(NewJobsCollector(*jobsPending, *jobsMaxSeries)) // from jobs.go
+	}
+
+	// Turn on the priority metrics only if the corresponding command line option is set to true.
+	if *priorityInfo {
+		prometheus.MustRegister(NewPriorityCollector()) // from priority.go
+	}
+
+	// Turn on the QOS metrics only if the corresponding command line option is set to true.
+	if *qosInfo {
+		prometheus.MustRegister(NewQOSCollector()) // from qos.go
+	}
+
+	// Turn on the job array metrics only if the corresponding command line option is set to true.
+	if *arraysInfo {
+		prometheus.MustRegister(NewArraysCollector()) // from arrays.go
+	}
+
+	// Turn on the dependency metrics only if the corresponding command line option is set to true.
+	if *dependenciesInfo {
+		prometheus.MustRegister(NewDependencyCollector()) // from dependencies.go
+	}
+
+	// Turn on the wait and run time of jobs only if the corresponding command line option is set to true.
+	if *jobTimesInfo {
+		prometheus.MustRegister(NewJobTimesCollector()) // from jobtimes.go
+	}
+
+	// Turn on the license metrics only if the corresponding command line option is set to true.
+	if *licensesInfo {
+		prometheus.MustRegister(NewLicensesCollector()) // from licenses.go
+	}
+
+	// Turn on the reservation metrics only if the corresponding command line option is set to true.
+	if *reservationsInfo {
+		prometheus.MustRegister(NewReservationsCollector()) // from reservations.go
+	}
+
 	// The Handler function provides a default handler to expose metrics
 	// via an HTTP server. "/metrics" is the usual endpoint for that.
 	log.Infof("Starting Server: %s", *listenAddress)
 	log.Infof("GPUs Accounting: %t", *gpuAcct)
+	log.Infof("GRES Accounting: %t", *gresAcct)
 	http.Handle("/metrics", promhttp.Handler())
 	log.Fatal(http.ListenAndServe(*listenAddress, nil))
 }
@@ -56,6 +56,62 @@ func PartitionsPendingJobsData() []byte {
         return out
 }
 
+// Resources requested by pending jobs, memory in megabytes
+type PartitionDemand struct {
+        cpus float64
+        mem float64
+        nodes float64
+        gpus float64
+}
+
+// The account is left empty unless the demand is accounted per account
+type PartitionDemandKey struct {
+        partition string
+        account string
+}
+
+// ParsePartitionsPendingDemand takes the output of "scontrol show job" for all jobs
+// It returns the resources requested by pending jobs per partition, and per account if byAccount is set
+func ParsePartitionsPendingDemand(input []byte, byAccount bool) map[PartitionDemandKey]*PartitionDemand {
+        demand := make(map[PartitionDemandKey]*PartitionDemand)
+        for _, job := range ParseScontrolJobs(input) {
+                if job.fields["JobState"] != "PENDING" {
+                        continue
+                }
+                jobs, partitions := PendingJobShares(job)
+                cpus, _ := strconv.ParseFloat(job.fields["NumCPUs"], 64)
+                nodes := ParseNodeCount(job.fields["NumNodes"])
+                // The minimum memory is requested either per CPU or per node
+                var mem float64
+                if perCPU, ok := job.fields["MinMemoryCPU"]; ok {
+                        mem, _ = ParseSlurmMemory(perCPU, 1<<20)
+                        mem *= cpus
+                } else {
+                        mem, _ = ParseSlurmMemory(job.fields["MinMemoryNode"], 1<<20)
+                        mem *= nodes
+                }
+                var gpus float64
+                for _, count := range JobRequestedGPUs(job.fields) {
+                        gpus += count
+                }
+                account := ""
+                if byAccount {
+                        account = job.fields["Account"]
+                }
+                for _, partition := range partitions {
+                        key := PartitionDemandKey{partition, account}
+                        if _, ok := demand[key]; !ok {
+                                demand[key] = &PartitionDemand{}
+                        }
+                        demand[key].cpus += cpus * jobs
+                        demand[key].mem += mem * jobs / (1 << 20)
+                        demand[key].nodes += nodes * jobs
+                        demand[key].gpus += gpus * jobs
+                }
+        }
+        return demand
+}
+
 type PartitionMetrics struct {
         allocated float64
         idle float64
@@ -106,11 +162,29 @@ type PartitionsCollector struct {
         other *prometheus.Desc
         pending *prometheus.Desc
         total *prometheus.Desc
+        demand bool
+        byAccount bool
+        pendingCPUs *prometheus.Desc
+        pendingMem *prometheus.Desc
+        pendingNodes *prometheus.Desc
+        pendingGPUs *prometheus.Desc
 }
 
-func NewPartitionsCollector() *PartitionsCollector {
+// NewPartitionsCollector returns the partitions collector, the resources requested by pending
+// jobs are collected only if demand is set and additionally labelled by account if byAccount is set
+func NewPartitionsCollector(demand bool, byAccount bool) *PartitionsCollector {
         labels := []string{"partition"}
+        demandLabels := labels
+        if byAccount {
+                demandLabels = []string{"partition", "account"}
+        }
         return &PartitionsCollector{
+                demand: demand,
+                byAccount: byAccount,
+                pendingCPUs: prometheus.NewDesc("slurm_partition_pending_cpus", "CPUs requested by pending jobs for partition", demandLabels, nil),
+                pendingMem: prometheus.NewDesc("slurm_partition_pending_mem", "Memory in megabytes requested by pending jobs for partition", demandLabels, nil),
+                pendingNodes: prometheus.NewDesc("slurm_partition_pending_nodes", "Nodes requested by pending jobs for partition", demandLabels, nil),
+                pendingGPUs: prometheus.NewDesc("slurm_partition_pending_gpus", "GPUs requested by pending jobs for partition", demandLabels, nil),
                 allocated: prometheus.NewDesc("slurm_partition_cpus_allocated", "Allocated CPUs for partition", labels,nil),
 		idle: prometheus.NewDesc("slurm_partition_cpus_idle", "Idle CPUs for partition", labels,nil),
 		other: prometheus.NewDesc("slurm_partition_cpus_other", "Other CPUs for partition", labels,nil),
@@ -125,6 +199,12 @@ func (pc *PartitionsCollector) Describe(ch chan<- *prometheus.Desc) {
         ch <- pc.other
         ch <- pc.pending
         ch <- pc.total
+        if pc.demand {
+                ch <- pc.pendingCPUs
+                ch <- pc.pendingMem
+                ch <- pc.pendingNodes
+                ch <- pc.pendingGPUs
+        }
 }
 
 func (pc *PartitionsCollector) Collect(ch chan<- prometheus.Metric) {
@@ -146,4 +226,18 @@ func (pc *PartitionsCollector) Collect(ch chan<- prometheus.Metric) {
                         ch <- prometheus.MustNewConstMetric(pc.total, prometheus.GaugeValue, pm[p].total, p)
                 }
         }
+        // The jobs are queried with scontrol only if the demand of pending jobs is enabled
+        if !pc.demand {
+                return
+        }
+        for key, demand := range ParsePartitionsPendingDemand(ScontrolJobsData(), pc.byAccount) {
+                labels := []string{key.partition}
+                if pc.byAccount {
+                        labels = append(labels, key.account)
+                }
+                ch <- prometheus.MustNewConstMetric(pc.pendingCPUs, prometheus.GaugeValue, demand.cpus, labels...)
+                ch <- prometheus.MustNewConstMetric(pc.pendingMem, prometheus.GaugeValue, demand.mem, labels...)
+                ch <- prometheus.MustNewConstMetric(pc.pendingNodes, prometheus.GaugeValue, demand.nodes, labels...)
+                ch <- prometheus.MustNewConstMetric(pc.pendingGPUs, prometheus.GaugeValue, demand.gpus, labels...)
+        }
 }
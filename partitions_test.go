@@ -0,0 +1,45 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPartitionsPendingDemand(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/scontrol_jobs_demand.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	demand := ParsePartitionsPendingDemand(data, false)
+	t.Logf("%+v", demand)
+
+	assert.Len(t, demand, 3)
+	// Memory per CPU is multiplied with the CPUs, every pending task of a job array is accounted for
+	assert.Equal(t, &PartitionDemand{cpus: 163, mem: 8192 + 2000 + 128*2048 + 2*1024, nodes: 9}, demand[PartitionDemandKey{"batch", ""}])
+	assert.Equal(t, &PartitionDemand{cpus: 48, mem: 65536 + 262144, nodes: 3, gpus: 8}, demand[PartitionDemandKey{"gpu", ""}])
+	// The minimum number of nodes of a flexible request
+	assert.Equal(t, &PartitionDemand{cpus: 32, mem: 262144, nodes: 2, gpus: 4}, demand[PartitionDemandKey{"gpu-long", ""}])
+
+	demand = ParsePartitionsPendingDemand(data, true)
+	assert.Len(t, demand, 4)
+	assert.Equal(t, 33.0, demand[PartitionDemandKey{"batch", "chemistry"}].cpus)
+	assert.Equal(t, 130.0, demand[PartitionDemandKey{"batch", "physics"}].cpus)
+}
@@ -0,0 +1,230 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Priority factors with the sprio format of their weighted value
+var priorityFactors = []struct {
+	name   string
+	format string
+}{
+	{"age", "%A"},
+	{"fairshare", "%F"},
+	{"jobsize", "%J"},
+	{"partition", "%P"},
+	{"qos", "%Q"},
+	{"tres", "%T"},
+	{"assoc", "%B"},
+}
+
+// Priority weights as named by "scontrol show config"
+var priorityWeights = map[string]string{
+	"PriorityWeightAge":       "age",
+	"PriorityWeightAssoc":     "assoc",
+	"PriorityWeightFairShare": "fairshare",
+	"PriorityWeightJobSize":   "jobsize",
+	"PriorityWeightPartition": "partition",
+	"PriorityWeightQOS":       "qos",
+}
+
+// Quantiles of the priority of pending jobs, including minimum and maximum
+var priorityQuantiles = []float64{0, 0.25, 0.5, 0.75, 1}
+
+// PriorityFactorKey groups the priority factors by account
+type PriorityFactorKey struct {
+	account string
+	factor  string
+}
+
+type PriorityMetrics struct {
+	pending     map[string][]float64
+	factors     map[PriorityFactorKey]float64
+	jobs        map[string]float64
+	weights     map[string]float64
+	tresWeights map[string]float64
+}
+
+// Execute the scontrol command to get the configuration of the priority weights
+func PriorityConfigData() []byte {
+	return Execute("scontrol", []string{"show", "config"})
+}
+
+// Execute the sprio command to get the weighted priority factors of all pending
+// jobs, in the order of the given factors
+func PriorityData(factors []string) []byte {
+	format := []string{"%i", "%r", "%o", "%Y"}
+	for _, factor := range factors {
+		for _, pf := range priorityFactors {
+			if pf.name == factor {
+				format = append(format, pf.format)
+			}
+		}
+	}
+	return Execute("sprio", []string{"-h", "-o", strings.Join(format, "|")})
+}
+
+// ParsePriorityWeights takes the output of "scontrol show config" and returns
+// the weight of every priority factor and of every TRES
+func ParsePriorityWeights(input []byte) (map[string]float64, map[string]float64) {
+	weights := make(map[string]float64)
+	tresWeights := make(map[string]float64)
+	for _, line := range strings.Split(string(input), "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		key := strings.TrimSpace(kv[0])
+		value := strings.TrimSpace(kv[1])
+		if key == "PriorityWeightTRES" {
+			// e.g. "CPU=1000,Mem=2000,GRES/gpu=3000", the weight of the TRES
+			// factor is the sum of the weights of all TRES
+			for _, item := range strings.Split(value, ",") {
+				tres := strings.SplitN(item, "=", 2)
+				if len(tres) == 2 {
+					weight, _ := strconv.ParseFloat(tres[1], 64)
+					tresWeights[strings.ToLower(tres[0])] = weight
+					weights["tres"] += weight
+				}
+			}
+			continue
+		}
+		if factor, ok := priorityWeights[key]; ok {
+			weights[factor], _ = strconv.ParseFloat(value, 64)
+		}
+	}
+	return weights, tresWeights
+}
+
+// Factors configured in the weights, the association factor is only known
+// to recent Slurm versions and is skipped otherwise
+func configuredPriorityFactors(weights map[string]float64) []string {
+	var factors []string
+	for _, pf := range priorityFactors {
+		if _, ok := weights[pf.name]; ok || pf.name != "assoc" {
+			factors = append(factors, pf.name)
+		}
+	}
+	return factors
+}
+
+// Sum up a weighted priority factor, the TRES factor is printed per TRES like "cpu=10,mem=20"
+func parsePriorityFactor(field string) float64 {
+	var sum float64
+	for _, item := range strings.Split(field, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		value, _ := strconv.ParseFloat(strings.TrimSpace(kv[len(kv)-1]), 64)
+		sum += value
+	}
+	return sum
+}
+
+// ParsePriorityMetrics takes the output of sprio with the given factors
+// It returns the priority of the pending jobs per partition and the sum of
+// every weighted factor per account. sprio prints a line for every partition a
+// job is pending in, the factors of a job are only summed up once
+func ParsePriorityMetrics(input []byte, factors []string) *PriorityMetrics {
+	pm := PriorityMetrics{
+		pending: make(map[string][]float64),
+		factors: make(map[PriorityFactorKey]float64),
+		jobs:    make(map[string]float64),
+	}
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 4+len(factors) {
+			continue
+		}
+		partition := strings.TrimSpace(fields[1])
+		account := strings.TrimSpace(fields[2])
+		priority, _ := strconv.ParseFloat(strings.TrimSpace(fields[3]), 64)
+		pm.pending[partition] = append(pm.pending[partition], priority)
+		jobid := strings.TrimSpace(fields[0])
+		if seen[jobid] {
+			continue
+		}
+		seen[jobid] = true
+		pm.jobs[account]++
+		for i, factor := range factors {
+			pm.factors[PriorityFactorKey{account, factor}] += parsePriorityFactor(fields[4+i])
+		}
+	}
+	return &pm
+}
+
+func PriorityGetMetrics() *PriorityMetrics {
+	weights, tresWeights := ParsePriorityWeights(PriorityConfigData())
+	factors := configuredPriorityFactors(weights)
+	pm := ParsePriorityMetrics(PriorityData(factors), factors)
+	pm.weights = weights
+	pm.tresWeights = tresWeights
+	return pm
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm job priorities into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+func NewPriorityCollector() *PriorityCollector {
+	return &PriorityCollector{
+		pending:    prometheus.NewDesc("slurm_priority_pending", "Distribution of the priority of pending jobs", []string{"partition"}, nil),
+		factor:     prometheus.NewDesc("slurm_priority_factor_average", "Average weighted priority factor of pending jobs for account", []string{"account", "factor"}, nil),
+		weight:     prometheus.NewDesc("slurm_priority_weight", "Configured weight of the priority factor", []string{"factor"}, nil),
+		tresWeight: prometheus.NewDesc("slurm_priority_tres_weight", "Configured weight of the TRES in the priority", []string{"tres"}, nil),
+	}
+}
+
+type PriorityCollector struct {
+	pending    *prometheus.Desc
+	factor     *prometheus.Desc
+	weight     *prometheus.Desc
+	tresWeight *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (pc *PriorityCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- pc.pending
+	ch <- pc.factor
+	ch <- pc.weight
+	ch <- pc.tresWeight
+}
+
+func (pc *PriorityCollector) Collect(ch chan<- prometheus.Metric) {
+	pm := PriorityGetMetrics()
+	for p := range pm.pending {
+		var sum float64
+		for _, priority := range pm.pending[p] {
+			sum += priority
+		}
+		ch <- prometheus.MustNewConstSummary(pc.pending, uint64(len(pm.pending[p])), sum, Quantiles(pm.pending[p], priorityQuantiles), p)
+	}
+	for key, sum := range pm.factors {
+		ch <- prometheus.MustNewConstMetric(pc.factor, prometheus.GaugeValue, sum/pm.jobs[key.account], key.account, key.factor)
+	}
+	for factor, weight := range pm.weights {
+		ch <- prometheus.MustNewConstMetric(pc.weight, prometheus.GaugeValue, weight, factor)
+	}
+	for tres, weight := range pm.tresWeights {
+		ch <- prometheus.MustNewConstMetric(pc.tresWeight, prometheus.GaugeValue, weight, tres)
+	}
+}
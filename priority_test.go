@@ -0,0 +1,67 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPriorityWeights(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/scontrol_config.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	weights, tresWeights := ParsePriorityWeights(data)
+	t.Logf("%+v %+v", weights, tresWeights)
+
+	assert.Len(t, weights, 7)
+	assert.Equal(t, 10000.0, weights["fairshare"])
+	assert.Equal(t, 6000.0, weights["tres"])
+	assert.Equal(t, 3000.0, tresWeights["gres/gpu"])
+	assert.Equal(t, []string{"age", "fairshare", "jobsize", "partition", "qos", "tres", "assoc"}, configuredPriorityFactors(weights))
+
+	// Slurm versions without association factor
+	delete(weights, "assoc")
+	assert.Equal(t, []string{"age", "fairshare", "jobsize", "partition", "qos", "tres"}, configuredPriorityFactors(weights))
+}
+
+func TestPriorityMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/sprio.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	factors := []string{"age", "fairshare", "jobsize", "partition", "qos", "tres", "assoc"}
+	pm := ParsePriorityMetrics(data, factors)
+	t.Logf("%+v", pm)
+
+	assert.Equal(t, []float64{15000, 11000}, pm.pending["gpu"])
+	assert.Equal(t, []float64{14500}, pm.pending["gpu-long"])
+	// A job pending in several partitions is accounted for once per account
+	assert.Equal(t, 2.0, pm.jobs["vision"])
+	assert.Equal(t, 2.0, pm.jobs["chemistry"])
+	assert.Equal(t, 14000.0, pm.factors[PriorityFactorKey{"vision", "fairshare"}])
+	assert.Equal(t, 5400.0, pm.factors[PriorityFactorKey{"vision", "tres"}])
+	assert.Equal(t, 500.0, pm.factors[PriorityFactorKey{"chemistry", "tres"}])
+
+	quantiles := Quantiles(pm.pending["gpu"], priorityQuantiles)
+	assert.Equal(t, 11000.0, quantiles[0])
+	assert.Equal(t, 15000.0, quantiles[1])
+}
@@ -0,0 +1,197 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// QOSTRESKey identifies a limit of a QOS on a trackable resource
+type QOSTRESKey struct {
+	qos  string
+	tres string
+}
+
+// QOSJobsMetrics counts the jobs in the queue of a QOS
+type QOSJobsMetrics struct {
+	running     float64
+	pending     float64
+	runningCPUs float64
+	runningGPUs float64
+}
+
+// QOSLimits stores the configuration of a QOS as defined in the accounting database
+type QOSLimits struct {
+	priority    float64
+	maxWall     float64
+	hasMaxWall  bool
+	preemptMode string
+}
+
+type QOSMetrics struct {
+	jobs           map[string]*QOSJobsMetrics
+	limits         map[string]*QOSLimits
+	maxTRESPerUser map[QOSTRESKey]float64
+	grpTRES        map[QOSTRESKey]float64
+}
+
+// Execute the sacctmgr command to get the configured limits of every QOS
+func QOSLimitsData() []byte {
+	args := []string{"show", "qos", "-P", "-n", "format=Name,Priority,MaxWall,MaxTRESPU,GrpTRES,PreemptMode"}
+	return Execute("sacctmgr", args)
+}
+
+// ParseQOSJobs takes the output of "scontrol show job" and counts the jobs, CPUs
+// and GPUs per QOS. The components of a heterogeneous job are counted as one
+// job with the CPUs and GPUs of all components.
+func ParseQOSJobs(input []byte) map[string]*QOSJobsMetrics {
+	jobs := make(map[string]*QOSJobsMetrics)
+	for _, job := range ParseScontrolJobs(input) {
+		state := job.fields["JobState"]
+		if state != "PENDING" && state != "RUNNING" {
+			continue
+		}
+		qos := job.fields["QOS"]
+		if _, ok := jobs[qos]; !ok {
+			jobs[qos] = &QOSJobsMetrics{}
+		}
+		count := 1.0
+		if offset, ok := job.fields["HetJobOffset"]; ok && offset != "0" {
+			count = 0
+		}
+		switch state {
+		case "PENDING":
+			tasks, _ := PendingJobShares(job)
+			jobs[qos].pending += count * tasks
+		case "RUNNING":
+			jobs[qos].running += count
+			cpus, _ := strconv.ParseFloat(job.fields["NumCPUs"], 64)
+			jobs[qos].runningCPUs += cpus
+			for _, gpus := range JobRequestedGPUs(job.fields) {
+				jobs[qos].runningGPUs += gpus
+			}
+		}
+	}
+	return jobs
+}
+
+// ParseQOSLimits takes the output of sacctmgr and returns the configuration of
+// every QOS and its TRES limits, limits which are not set are skipped
+func ParseQOSLimits(input []byte) (map[string]*QOSLimits, map[QOSTRESKey]float64, map[QOSTRESKey]float64) {
+	limits := make(map[string]*QOSLimits)
+	maxTRESPerUser := make(map[QOSTRESKey]float64)
+	grpTRES := make(map[QOSTRESKey]float64)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 6 || len(fields[0]) == 0 {
+			continue
+		}
+		qos := fields[0]
+		ql := QOSLimits{preemptMode: fields[5]}
+		ql.priority, _ = strconv.ParseFloat(fields[1], 64)
+		if maxWall, err := ParseSlurmDuration(fields[2]); err == nil && len(fields[2]) > 0 {
+			ql.maxWall = maxWall
+			ql.hasMaxWall = true
+		}
+		limits[qos] = &ql
+		for tres, count := range ParseTRES(fields[3]) {
+			maxTRESPerUser[QOSTRESKey{qos, tres}] = count
+		}
+		for tres, count := range ParseTRES(fields[4]) {
+			grpTRES[QOSTRESKey{qos, tres}] = count
+		}
+	}
+	return limits, maxTRESPerUser, grpTRES
+}
+
+func QOSGetMetrics() *QOSMetrics {
+	qm := QOSMetrics{jobs: ParseQOSJobs(ScontrolJobsData())}
+	qm.limits, qm.maxTRESPerUser, qm.grpTRES = ParseQOSLimits(QOSLimitsData())
+	return &qm
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm QOS metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+func NewQOSCollector() *QOSCollector {
+	labels := []string{"qos"}
+	tresLabels := []string{"qos", "tres"}
+	return &QOSCollector{
+		running:        prometheus.NewDesc("slurm_qos_jobs_running", "Running jobs for QOS", labels, nil),
+		pending:        prometheus.NewDesc("slurm_qos_jobs_pending", "Pending jobs for QOS", labels, nil),
+		runningCPUs:    prometheus.NewDesc("slurm_qos_cpus_running", "Running CPUs for QOS", labels, nil),
+		runningGPUs:    prometheus.NewDesc("slurm_qos_gpus_running", "Running GPUs for QOS", labels, nil),
+		priority:       prometheus.NewDesc("slurm_qos_priority", "Configured priority of the QOS", labels, nil),
+		maxWall:        prometheus.NewDesc("slurm_qos_max_wall_seconds", "Configured maximum wall clock time of jobs for QOS", labels, nil),
+		maxTRESPerUser: prometheus.NewDesc("slurm_qos_max_tres_per_user", "Configured maximum TRES per user for QOS, memory in megabytes", tresLabels, nil),
+		grpTRES:        prometheus.NewDesc("slurm_qos_grp_tres", "Configured maximum TRES of all jobs for QOS, memory in megabytes", tresLabels, nil),
+		info:           prometheus.NewDesc("slurm_qos_info", "Configured preempt mode of the QOS", []string{"qos", "preempt_mode"}, nil),
+	}
+}
+
+type QOSCollector struct {
+	running        *prometheus.Desc
+	pending        *prometheus.Desc
+	runningCPUs    *prometheus.Desc
+	runningGPUs    *prometheus.Desc
+	priority       *prometheus.Desc
+	maxWall        *prometheus.Desc
+	maxTRESPerUser *prometheus.Desc
+	grpTRES        *prometheus.Desc
+	info           *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (qc *QOSCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- qc.running
+	ch <- qc.pending
+	ch <- qc.runningCPUs
+	ch <- qc.runningGPUs
+	ch <- qc.priority
+	ch <- qc.maxWall
+	ch <- qc.maxTRESPerUser
+	ch <- qc.grpTRES
+	ch <- qc.info
+}
+
+func (qc *QOSCollector) Collect(ch chan<- prometheus.Metric) {
+	qm := QOSGetMetrics()
+	for qos, jobs := range qm.jobs {
+		ch <- prometheus.MustNewConstMetric(qc.running, prometheus.GaugeValue, jobs.running, qos)
+		ch <- prometheus.MustNewConstMetric(qc.pending, prometheus.GaugeValue, jobs.pending, qos)
+		ch <- prometheus.MustNewConstMetric(qc.runningCPUs, prometheus.GaugeValue, jobs.runningCPUs, qos)
+		ch <- prometheus.MustNewConstMetric(qc.runningGPUs, prometheus.GaugeValue, jobs.runningGPUs, qos)
+	}
+	for qos, limits := range qm.limits {
+		ch <- prometheus.MustNewConstMetric(qc.priority, prometheus.GaugeValue, limits.priority, qos)
+		if limits.hasMaxWall {
+			ch <- prometheus.MustNewConstMetric(qc.maxWall, prometheus.GaugeValue, limits.maxWall, qos)
+		}
+		ch <- prometheus.MustNewConstMetric(qc.info, prometheus.GaugeValue, 1, qos, limits.preemptMode)
+	}
+	for key, count := range qm.maxTRESPerUser {
+		ch <- prometheus.MustNewConstMetric(qc.maxTRESPerUser, prometheus.GaugeValue, count, key.qos, key.tres)
+	}
+	for key, count := range qm.grpTRES {
+		ch <- prometheus.MustNewConstMetric(qc.grpTRES, prometheus.GaugeValue, count, key.qos, key.tres)
+	}
+}
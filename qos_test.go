@@ -0,0 +1,57 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQOSJobs(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/scontrol_jobs_qos.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	jobs := ParseQOSJobs(data)
+	t.Logf("%+v", jobs)
+
+	assert.Equal(t, &QOSJobsMetrics{running: 2, pending: 1, runningCPUs: 24, runningGPUs: 2}, jobs["normal"])
+	// A heterogeneous job is counted once with the GPUs of all components
+	assert.Equal(t, &QOSJobsMetrics{running: 1, pending: 2, runningCPUs: 64, runningGPUs: 8}, jobs["gpu"])
+	assert.Equal(t, &QOSJobsMetrics{pending: 1}, jobs["long"])
+}
+
+func TestQOSLimits(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/sacctmgr_qos.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	limits, maxTRESPerUser, grpTRES := ParseQOSLimits(data)
+	t.Logf("%+v %+v %+v", limits, maxTRESPerUser, grpTRES)
+
+	assert.Len(t, limits, 4)
+	assert.Equal(t, &QOSLimits{priority: 100, maxWall: 86400, hasMaxWall: true, preemptMode: "cluster"}, limits["gpu"])
+	assert.Equal(t, &QOSLimits{preemptMode: "cancel"}, limits["scavenger"])
+	assert.Equal(t, 16.0, maxTRESPerUser[QOSTRESKey{"gpu", "gres/gpu"}])
+	assert.Equal(t, 1024.0*1024, maxTRESPerUser[QOSTRESKey{"gpu", "mem"}])
+	assert.Len(t, maxTRESPerUser, 5)
+	assert.Equal(t, 32.0, grpTRES[QOSTRESKey{"long", "node"}])
+	assert.Len(t, grpTRES, 3)
+}
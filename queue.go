@@ -20,6 +20,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os/exec"
+	"strconv"
 	"strings"
 )
 
@@ -36,6 +37,78 @@ type QueueMetrics struct {
 	timeout     float64
 	preempted   float64
 	node_fail   float64
+	jobs        map[QueueJobsKey]float64
+	reasons     map[PendingReasonKey]float64
+	// Heterogeneous jobs and their components per state
+	het_jobs       map[string]float64
+	het_components map[string]float64
+}
+
+// QueueJobsKey groups the jobs in the queue by state and partition
+type QueueJobsKey struct {
+	state     string
+	partition string
+}
+
+// HetJobComponent splits the ID of a heterogeneous job component like "123+1"
+// into the ID of the heterogeneous job and the offset of the component
+func HetJobComponent(jobid string) (string, int, bool) {
+	parts := strings.SplitN(strings.TrimSpace(jobid), "+", 2)
+	if len(parts) != 2 {
+		return "", 0, false
+	}
+	offset, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return "", 0, false
+	}
+	return parts[0], offset, true
+}
+
+// hetJobKey marks a heterogeneous job as counted for a state and partition,
+// the empty partition marks it as counted in the totals
+type hetJobKey struct {
+	id  string
+	key QueueJobsKey
+}
+
+// PendingReasonKey groups the pending jobs by reason and partition
+type PendingReasonKey struct {
+	reason    string
+	partition string
+}
+
+// pendingReasonPrefixes maps the prefixes of the reasons of pending jobs to
+// their category, reasons may carry details like "ReqNodeNotAvail, UnavailableNodes:cn[001-002]"
+var pendingReasonPrefixes = []struct {
+	prefix   string
+	category string
+}{
+	{"Resources", "resources"},
+	{"ReqNodeNotAvail", "resources"},
+	{"Licenses", "resources"},
+	{"NodeDown", "resources"},
+	{"Priority", "priority"},
+	{"Dependency", "dependency"},
+	{"JobHeld", "held"},
+	{"BeginTime", "held"},
+	// Limits of QOS and associations, e.g. QOSMaxCpuPerUserLimit or AssocGrpGRES
+	{"QOS", "limits"},
+	{"Assoc", "limits"},
+}
+
+// PendingReasonCategory groups the reasons of pending jobs into the categories
+// resources, priority, limits, held, dependency and other
+func PendingReasonCategory(reason string) string {
+	for _, p := range pendingReasonPrefixes {
+		if strings.HasPrefix(reason, p.prefix) {
+			return p.category
+		}
+	}
+	// Limits of partitions, e.g. PartitionTimeLimit
+	if name := strings.SplitN(reason, ",", 2)[0]; strings.HasSuffix(name, "Limit") {
+		return "limits"
+	}
+	return "other"
 }
 
 // Returns the scheduler metrics
@@ -45,15 +118,61 @@ func QueueGetMetrics() *QueueMetrics {
 
 func ParseQueueMetrics(input []byte) *QueueMetrics {
 	var qm QueueMetrics
+	qm.jobs = make(map[QueueJobsKey]float64)
+	qm.reasons = make(map[PendingReasonKey]float64)
+	qm.het_jobs = make(map[string]float64)
+	qm.het_components = make(map[string]float64)
+	hetSeen := make(map[hetJobKey]bool)
 	lines := strings.Split(string(input), "\n")
 	for _, line := range lines {
-		if strings.Contains(line, ",") {
-			splitted := strings.Split(line, ",")
+		if strings.Contains(line, "|") {
+			// The reason is the last field since it may contain commas and spaces,
+			// e.g. "ReqNodeNotAvail, UnavailableNodes:cn[001-002]"
+			splitted := strings.SplitN(line, "|", 5)
 			state := splitted[1]
+			// Only the name of the reason is kept since the details like the list
+			// of unavailable nodes would create a new series on every change
+			reason := ""
+			if len(splitted) > 4 {
+				reason = strings.TrimSpace(strings.SplitN(splitted[4], ",", 2)[0])
+			}
+			// The components of a heterogeneous job are counted once per het job,
+			// in every partition used by any of its components
+			hetJobID := ""
+			if len(splitted) > 2 {
+				if id, _, ok := HetJobComponent(splitted[2]); ok {
+					hetJobID = id
+					qm.het_components[strings.ToLower(state)]++
+				}
+			}
+			// Pending jobs submitted to multiple partitions are accounted for in every one of them
+			if len(splitted) > 3 {
+				for _, partition := range strings.Split(splitted[3], ",") {
+					key := QueueJobsKey{strings.ToLower(state), partition}
+					if hetJobID != "" {
+						if hetSeen[hetJobKey{hetJobID, key}] {
+							continue
+						}
+						hetSeen[hetJobKey{hetJobID, key}] = true
+					}
+					qm.jobs[key]++
+					if state == "PENDING" {
+						qm.reasons[PendingReasonKey{reason, partition}]++
+					}
+				}
+			}
+			if hetJobID != "" {
+				key := hetJobKey{hetJobID, QueueJobsKey{strings.ToLower(state), ""}}
+				if hetSeen[key] {
+					continue
+				}
+				hetSeen[key] = true
+				qm.het_jobs[strings.ToLower(state)]++
+			}
 			switch state {
 			case "PENDING":
 				qm.pending++
-				if len(splitted) > 2 && splitted[2] == "Dependency" {
+				if reason == "Dependency" {
 					qm.pending_dep++
 				}
 			case "RUNNING":
@@ -84,7 +203,7 @@ func ParseQueueMetrics(input []byte) *QueueMetrics {
 
 // Execute the squeue command and return its output
 func QueueData() []byte {
-	cmd := exec.Command("squeue", "-a", "-r", "-h", "-o %A,%T,%r", "--states=all")
+	cmd := exec.Command("squeue", "-a", "-r", "-h", "-o %A|%T|%i|%P|%r", "--states=all")
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		log.Fatal(err)
@@ -105,8 +224,12 @@ func QueueData() []byte {
  * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
  */
 
-func NewQueueCollector() *QueueCollector {
+// NewQueueCollector returns the queue collector, with reasonCategories set the
+// reasons of pending jobs are additionally exported grouped into categories
+func NewQueueCollector(reasonCategories bool) *QueueCollector {
 	return &QueueCollector{
+		reasonCategories: reasonCategories,
+
 		pending:     prometheus.NewDesc("slurm_queue_pending", "Pending jobs in queue", nil, nil),
 		pending_dep: prometheus.NewDesc("slurm_queue_pending_dependency", "Pending jobs because of dependency in queue", nil, nil),
 		running:     prometheus.NewDesc("slurm_queue_running", "Running jobs in the cluster", nil, nil),
@@ -119,10 +242,18 @@ func NewQueueCollector() *QueueCollector {
 		timeout:     prometheus.NewDesc("slurm_queue_timeout", "Jobs stopped by timeout", nil, nil),
 		preempted:   prometheus.NewDesc("slurm_queue_preempted", "Number of preempted jobs", nil, nil),
 		node_fail:   prometheus.NewDesc("slurm_queue_node_fail", "Number of jobs stopped due to node fail", nil, nil),
+		jobs:        prometheus.NewDesc("slurm_queue_jobs", "Jobs in the queue by state and partition", []string{"state", "partition"}, nil),
+		reasons:     prometheus.NewDesc("slurm_queue_pending_reason", "Pending jobs by reason and partition", []string{"reason", "partition"}, nil),
+		categories:  prometheus.NewDesc("slurm_queue_pending_reason_category", "Pending jobs by category of reason and partition", []string{"category", "partition"}, nil),
+
+		het_jobs:       prometheus.NewDesc("slurm_queue_het_jobs", "Heterogeneous jobs in the queue by state", []string{"state"}, nil),
+		het_components: prometheus.NewDesc("slurm_queue_het_components", "Components of heterogeneous jobs in the queue by state", []string{"state"}, nil),
 	}
 }
 
 type QueueCollector struct {
+	reasonCategories bool
+
 	pending     *prometheus.Desc
 	pending_dep *prometheus.Desc
 	running     *prometheus.Desc
@@ -135,6 +266,12 @@ type QueueCollector struct {
 	timeout     *prometheus.Desc
 	preempted   *prometheus.Desc
 	node_fail   *prometheus.Desc
+	jobs        *prometheus.Desc
+	reasons     *prometheus.Desc
+	categories  *prometheus.Desc
+
+	het_jobs       *prometheus.Desc
+	het_components *prometheus.Desc
 }
 
 func (qc *QueueCollector) Describe(ch chan<- *prometheus.Desc) {
@@ -150,6 +287,13 @@ func (qc *QueueCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- qc.timeout
 	ch <- qc.preempted
 	ch <- qc.node_fail
+	ch <- qc.jobs
+	ch <- qc.reasons
+	if qc.reasonCategories {
+		ch <- qc.categories
+	}
+	ch <- qc.het_jobs
+	ch <- qc.het_components
 }
 
 func (qc *QueueCollector) Collect(ch chan<- prometheus.Metric) {
@@ -166,4 +310,23 @@ func (qc *QueueCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(qc.timeout, prometheus.GaugeValue, qm.timeout)
 	ch <- prometheus.MustNewConstMetric(qc.preempted, prometheus.GaugeValue, qm.preempted)
 	ch <- prometheus.MustNewConstMetric(qc.node_fail, prometheus.GaugeValue, qm.node_fail)
+	for key, jobs := range qm.jobs {
+		ch <- prometheus.MustNewConstMetric(qc.jobs, prometheus.GaugeValue, jobs, key.state, key.partition)
+	}
+	categories := make(map[PendingReasonKey]float64)
+	for key, jobs := range qm.reasons {
+		ch <- prometheus.MustNewConstMetric(qc.reasons, prometheus.GaugeValue, jobs, key.reason, key.partition)
+		categories[PendingReasonKey{PendingReasonCategory(key.reason), key.partition}] += jobs
+	}
+	if qc.reasonCategories {
+		for key, jobs := range categories {
+			ch <- prometheus.MustNewConstMetric(qc.categories, prometheus.GaugeValue, jobs, key.reason, key.partition)
+		}
+	}
+	for state, jobs := range qm.het_jobs {
+		ch <- prometheus.MustNewConstMetric(qc.het_jobs, prometheus.GaugeValue, jobs, state)
+	}
+	for state, components := range qm.het_components {
+		ch <- prometheus.MustNewConstMetric(qc.het_components, prometheus.GaugeValue, components, state)
+	}
 }
@@ -19,6 +19,8 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestParseQueueMetrics(t *testing.T) {
@@ -31,6 +33,77 @@ func TestParseQueueMetrics(t *testing.T) {
 	t.Logf("%+v", ParseQueueMetrics(data))
 }
 
+func TestQueueJobsMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/squeue_partitions.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	qm := ParseQueueMetrics(data)
+	t.Logf("%+v", qm)
+
+	assert.Equal(t, 11.0, qm.pending)
+	assert.Equal(t, 3.0, qm.jobs[QueueJobsKey{"running", "batch"}])
+	assert.Equal(t, 2.0, qm.jobs[QueueJobsKey{"running", "gpu"}])
+	assert.Equal(t, 7.0, qm.jobs[QueueJobsKey{"pending", "batch"}])
+	assert.Equal(t, 4.0, qm.jobs[QueueJobsKey{"pending", "gpu"}])
+	assert.Equal(t, 1.0, qm.jobs[QueueJobsKey{"pending", "gpu-long"}])
+	assert.Equal(t, 1.0, qm.jobs[QueueJobsKey{"out_of_memory", "gpu"}])
+	// Reasons containing commas do not spill into the partitions
+	assert.Len(t, qm.jobs, 10)
+}
+
+func TestPendingReasonMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/squeue_partitions.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	qm := ParseQueueMetrics(data)
+
+	assert.Len(t, qm.reasons, 10)
+	// The details of a reason are dropped to bound the label values
+	assert.Equal(t, 2.0, qm.reasons[PendingReasonKey{"ReqNodeNotAvail", "gpu"}])
+	assert.Equal(t, 2.0, qm.reasons[PendingReasonKey{"Resources", "batch"}])
+	assert.Equal(t, 1.0, qm.reasons[PendingReasonKey{"QOSMaxCpuPerUserLimit", "batch"}])
+	assert.Equal(t, 1.0, qm.reasons[PendingReasonKey{"AssocGrpGRES", "gpu-long"}])
+	assert.Equal(t, 0.0, qm.reasons[PendingReasonKey{"None", "batch"}])
+
+	assert.Equal(t, "limits", PendingReasonCategory("QOSMaxCpuPerUserLimit"))
+	assert.Equal(t, "limits", PendingReasonCategory("AssocGrpGRES"))
+	assert.Equal(t, "limits", PendingReasonCategory("PartitionTimeLimit"))
+	assert.Equal(t, "resources", PendingReasonCategory("ReqNodeNotAvail"))
+	assert.Equal(t, "resources", PendingReasonCategory("ReqNodeNotAvail, UnavailableNodes:gpu[01-02]"))
+	assert.Equal(t, "held", PendingReasonCategory("JobHeldAdmin"))
+	assert.Equal(t, "held", PendingReasonCategory("BeginTime"))
+	assert.Equal(t, "dependency", PendingReasonCategory("DependencyNeverSatisfied"))
+	assert.Equal(t, "other", PendingReasonCategory("PartitionDown"))
+}
+
+func TestHetJobMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/squeue_partitions.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	qm := ParseQueueMetrics(data)
+
+	assert.Equal(t, map[string]float64{"running": 1, "pending": 1}, qm.het_jobs)
+	assert.Equal(t, map[string]float64{"running": 2, "pending": 3}, qm.het_components)
+	assert.Equal(t, 4.0, qm.running)
+	// A heterogeneous job is counted once in every partition of its components
+	assert.Equal(t, 2.0, qm.jobs[QueueJobsKey{"running", "gpu"}])
+	assert.Equal(t, 3.0, qm.jobs[QueueJobsKey{"running", "batch"}])
+	assert.Equal(t, 2.0, qm.reasons[PendingReasonKey{"Resources", "batch"}])
+
+	jobid, offset, ok := HetJobComponent("123+2")
+	assert.True(t, ok)
+	assert.Equal(t, "123", jobid)
+	assert.Equal(t, 2, offset)
+	_, _, ok = HetJobComponent("123_4")
+	assert.False(t, ok)
+}
+
 func TestQueueGetMetrics(t *testing.T) {
 	t.Logf("%+v", QueueGetMetrics())
 }
@@ -0,0 +1,190 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// ReservationMetrics stores the state of an advanced reservation
+type ReservationMetrics struct {
+	active    bool
+	nodes     float64
+	cpus      float64
+	cpusAlloc float64
+	cpusIdle  float64
+	start     time.Time
+	end       time.Time
+	flags     []string
+}
+
+type ReservationsMetrics struct {
+	reservations map[string]*ReservationMetrics
+	// Seconds until the start of the next maintenance reservation, zero
+	// while one is active and negative if none is scheduled
+	nextMaintenance float64
+}
+
+// Execute the scontrol command to get all reservations, one per line
+func ReservationsData() []byte {
+	return Execute("scontrol", []string{"show", "reservation", "-o"})
+}
+
+// ParseReservationsMetrics takes the output of "scontrol show reservation -o"
+// and the metrics of every node, the CPUs allocated and idle within a
+// reservation are summed up from its nodes and bounded by the CPUs of the reservation
+func ParseReservationsMetrics(input []byte, nodes map[string]*NodeMetrics, now time.Time) *ReservationsMetrics {
+	rm := ReservationsMetrics{
+		reservations:    make(map[string]*ReservationMetrics),
+		nextMaintenance: -1,
+	}
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := ParseScontrolFields(line)
+		name, ok := fields["ReservationName"]
+		if !ok {
+			continue
+		}
+		r := ReservationMetrics{active: fields["State"] == "ACTIVE"}
+		r.nodes, _ = strconv.ParseFloat(fields["NodeCnt"], 64)
+		r.start, _ = ParseSlurmTime(fields["StartTime"])
+		r.end, _ = ParseSlurmTime(fields["EndTime"])
+		if len(fields["Flags"]) > 0 {
+			r.flags = strings.Split(fields["Flags"], ",")
+		}
+		var cpusTotal float64
+		if fields["Nodes"] != "(null)" {
+			for _, node := range ExpandHostlist(fields["Nodes"]) {
+				if nm, ok := nodes[node]; ok {
+					r.cpusAlloc += float64(nm.cpuAlloc)
+					r.cpusIdle += float64(nm.cpuIdle)
+					cpusTotal += float64(nm.cpuTotal)
+				}
+			}
+		}
+		// Reservations of whole nodes do not list their CPUs in older Slurm versions,
+		// reservations of cores list at least their cores
+		var found bool
+		if r.cpus, found = ParseTRES(fields["TRES"])["cpu"]; !found {
+			if cores, _ := strconv.ParseFloat(fields["CoreCnt"], 64); cores > 0 {
+				r.cpus = cores
+			} else {
+				r.cpus = cpusTotal
+			}
+		}
+		// The CPUs of the nodes outside of a reservation of cores are not accounted for
+		if r.cpusAlloc > r.cpus {
+			r.cpusAlloc = r.cpus
+		}
+		if r.cpusIdle > r.cpus-r.cpusAlloc {
+			r.cpusIdle = r.cpus - r.cpusAlloc
+		}
+		rm.reservations[name] = &r
+		for _, flag := range r.flags {
+			if flag != "MAINT" || r.end.Before(now) {
+				continue
+			}
+			next := r.start.Sub(now).Seconds()
+			if next < 0 {
+				next = 0
+			}
+			if rm.nextMaintenance < 0 || next < rm.nextMaintenance {
+				rm.nextMaintenance = next
+			}
+		}
+	}
+	return &rm
+}
+
+func ReservationsGetMetrics() *ReservationsMetrics {
+	return ParseReservationsMetrics(ReservationsData(), NodeGetMetrics(), time.Now())
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * Slurm reservation metrics into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+func NewReservationsCollector() *ReservationsCollector {
+	labels := []string{"reservation"}
+	return &ReservationsCollector{
+		active:          prometheus.NewDesc("slurm_reservation_active", "Whether the reservation is active (1) or not (0)", labels, nil),
+		nodes:           prometheus.NewDesc("slurm_reservation_nodes", "Nodes in the reservation", labels, nil),
+		cpus:            prometheus.NewDesc("slurm_reservation_cpus", "CPUs in the reservation", labels, nil),
+		cpusAlloc:       prometheus.NewDesc("slurm_reservation_cpus_alloc", "Allocated CPUs on the nodes of the reservation", labels, nil),
+		cpusIdle:        prometheus.NewDesc("slurm_reservation_cpus_idle", "Idle CPUs on the nodes of the reservation", labels, nil),
+		start:           prometheus.NewDesc("slurm_reservation_start_time_seconds", "Start time of the reservation since epoch", labels, nil),
+		end:             prometheus.NewDesc("slurm_reservation_end_time_seconds", "End time of the reservation since epoch", labels, nil),
+		flag:            prometheus.NewDesc("slurm_reservation_flag", "Flag set on the reservation", []string{"reservation", "flag"}, nil),
+		nextMaintenance: prometheus.NewDesc("slurm_reservation_next_maintenance_seconds", "Seconds until the start of the next maintenance reservation, 0 while one is active", nil, nil),
+	}
+}
+
+type ReservationsCollector struct {
+	active          *prometheus.Desc
+	nodes           *prometheus.Desc
+	cpus            *prometheus.Desc
+	cpusAlloc       *prometheus.Desc
+	cpusIdle        *prometheus.Desc
+	start           *prometheus.Desc
+	end             *prometheus.Desc
+	flag            *prometheus.Desc
+	nextMaintenance *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (rc *ReservationsCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- rc.active
+	ch <- rc.nodes
+	ch <- rc.cpus
+	ch <- rc.cpusAlloc
+	ch <- rc.cpusIdle
+	ch <- rc.start
+	ch <- rc.end
+	ch <- rc.flag
+	ch <- rc.nextMaintenance
+}
+
+func (rc *ReservationsCollector) Collect(ch chan<- prometheus.Metric) {
+	rm := ReservationsGetMetrics()
+	for name, r := range rm.reservations {
+		var active float64
+		if r.active {
+			active = 1
+		}
+		ch <- prometheus.MustNewConstMetric(rc.active, prometheus.GaugeValue, active, name)
+		ch <- prometheus.MustNewConstMetric(rc.nodes, prometheus.GaugeValue, r.nodes, name)
+		ch <- prometheus.MustNewConstMetric(rc.cpus, prometheus.GaugeValue, r.cpus, name)
+		ch <- prometheus.MustNewConstMetric(rc.cpusAlloc, prometheus.GaugeValue, r.cpusAlloc, name)
+		ch <- prometheus.MustNewConstMetric(rc.cpusIdle, prometheus.GaugeValue, r.cpusIdle, name)
+		if !r.start.IsZero() {
+			ch <- prometheus.MustNewConstMetric(rc.start, prometheus.GaugeValue, float64(r.start.Unix()), name)
+		}
+		if !r.end.IsZero() {
+			ch <- prometheus.MustNewConstMetric(rc.end, prometheus.GaugeValue, float64(r.end.Unix()), name)
+		}
+		for _, flag := range r.flags {
+			ch <- prometheus.MustNewConstMetric(rc.flag, prometheus.GaugeValue, 1, name, flag)
+		}
+	}
+	if rm.nextMaintenance >= 0 {
+		ch <- prometheus.MustNewConstMetric(rc.nextMaintenance, prometheus.GaugeValue, rm.nextMaintenance)
+	}
+}
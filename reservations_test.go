@@ -0,0 +1,71 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReservationsMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/scontrol_reservations.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	nodeData, err := ioutil.ReadFile("test_data/sinfo_mem.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	now := time.Date(2026, 10, 19, 20, 0, 0, 0, time.Local)
+	rm := ParseReservationsMetrics(data, ParseNodeMetrics(nodeData), now)
+	t.Logf("%+v", rm.reservations)
+
+	assert.Len(t, rm.reservations, 4)
+	maint := rm.reservations["maint"]
+	assert.False(t, maint.active)
+	assert.Equal(t, 8.0, maint.nodes)
+	assert.Equal(t, 176.0, maint.cpus)
+	assert.Equal(t, []string{"MAINT", "IGNORE_JOBS", "SPEC_NODES", "ALL_NODES"}, maint.flags)
+	assert.Equal(t, time.Date(2026, 10, 20, 8, 0, 0, 0, time.Local), maint.start)
+
+	vision := rm.reservations["vision"]
+	assert.True(t, vision.active)
+	assert.Equal(t, 64.0, vision.cpus)
+	assert.Equal(t, 61.0, vision.cpusAlloc)
+	assert.Equal(t, 3.0, vision.cpusIdle)
+	assert.Nil(t, vision.flags)
+
+	// Only the CPUs of the reservation are accounted for on its nodes
+	partial := rm.reservations["partial"]
+	assert.Equal(t, 8.0, partial.cpus)
+	assert.Equal(t, 8.0, partial.cpusAlloc)
+	assert.Equal(t, 0.0, partial.cpusIdle)
+
+	matlab := rm.reservations["matlab"]
+	assert.Equal(t, 0.0, matlab.nodes)
+	assert.Equal(t, 0.0, matlab.cpus)
+
+	// The maintenance starts in 12 hours, while it is active the countdown stays at zero
+	assert.Equal(t, 12*3600.0, rm.nextMaintenance)
+	rm = ParseReservationsMetrics(data, nil, now.Add(13*time.Hour))
+	assert.Equal(t, 0.0, rm.nextMaintenance)
+	rm = ParseReservationsMetrics(data, nil, now.Add(25*time.Hour))
+	assert.Equal(t, -1.0, rm.nextMaintenance)
+}
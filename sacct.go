@@ -0,0 +1,131 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/log"
+)
+
+/*
+ * Collectors based on the accounting database poll sacct for the jobs
+ * which finished since their last poll. The end of the last polled time
+ * window is kept in a cursor, which can be persisted to a file so that
+ * a restart of the exporter neither counts jobs twice nor misses jobs.
+ */
+
+// Time format used by the Slurm commands for their input and output
+const slurmTimeFormat = "2006-01-02T15:04:05"
+
+// ParseSlurmTime parses a timestamp printed by a Slurm command in local time,
+// it fails for values like "N/A", "Unknown" or "None"
+func ParseSlurmTime(field string) (time.Time, error) {
+	return time.ParseInLocation(slurmTimeFormat, strings.TrimSpace(field), time.Local)
+}
+
+// Job states of finished jobs
+const sacctFinishedStates = "BF,CA,CD,DL,F,NF,OOM,PR,TO"
+
+// slurmdbd records the completion of jobs asynchronously, hence the end of
+// every polled time window lags the settle time behind the current time.
+// Jobs recorded later than that are missed.
+type SacctCursor struct {
+	path   string
+	last   time.Time
+	settle time.Duration
+}
+
+// NewSacctCursor returns a cursor loaded from path, or starting now if the
+// file does not exist. The cursor is not persisted if path is empty.
+func NewSacctCursor(path string, settle time.Duration) *SacctCursor {
+	c := SacctCursor{path: path, last: time.Now().Add(-settle).Truncate(time.Second), settle: settle}
+	if len(path) == 0 {
+		return &c
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Errorf("Can not read cursor %s: %v", path, err)
+		}
+		return &c
+	}
+	last, err := time.Parse(time.RFC3339, strings.TrimSpace(string(data)))
+	if err != nil {
+		log.Errorf("Can not parse cursor %s: %v", path, err)
+		return &c
+	}
+	c.last = last
+	return &c
+}
+
+// Window returns the time window to poll next
+func (c *SacctCursor) Window(now time.Time) (time.Time, time.Time) {
+	return c.last, now.Add(-c.settle).Truncate(time.Second)
+}
+
+// Advance moves the cursor to the end of a polled time window and persists it
+func (c *SacctCursor) Advance(end time.Time) {
+	c.last = end
+	if len(c.path) == 0 {
+		return
+	}
+	// Write to a temporary file first to never leave a truncated cursor behind
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(end.Format(time.RFC3339)+"\n"), 0644); err != nil {
+		log.Errorf("Can not write cursor %s: %v", tmp, err)
+		return
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		log.Errorf("Can not write cursor %s: %v", c.path, err)
+	}
+}
+
+// Arguments of the sacct command for the jobs which finished within the time window
+func finishedArgs(start time.Time, end time.Time, format string) []string {
+	return []string{
+		"-a", "-n", "-P",
+		"--state=" + sacctFinishedStates,
+		"-S", start.Format(slurmTimeFormat),
+		"-E", end.Format(slurmTimeFormat),
+		"-o", format,
+	}
+}
+
+// FinishedJobsData executes the sacct command to get the allocations of the
+// jobs which finished within the time window, with the fields given by format
+func FinishedJobsData(start time.Time, end time.Time, format string) []byte {
+	return Execute("sacct", append([]string{"-X"}, finishedArgs(start, end, format)...))
+}
+
+// FinishedStepsData executes the sacct command like FinishedJobsData, listing
+// the steps of every job (e.g. "4242.batch") after its allocation
+func FinishedStepsData(start time.Time, end time.Time, format string) []byte {
+	return Execute("sacct", finishedArgs(start, end, format))
+}
+
+// FinishedWithin checks if the end time printed by sacct lies within the
+// time window, excluding its start which belongs to the previous window
+func FinishedWithin(field string, start time.Time, end time.Time) bool {
+	t, err := ParseSlurmTime(field)
+	if err != nil {
+		return false
+	}
+	return t.After(start) && !t.After(end)
+}
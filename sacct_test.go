@@ -0,0 +1,46 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSacctCursor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "slurm-exporter")
+	if err != nil {
+		t.Fatalf("Can not create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "test.cursor")
+
+	now := time.Now()
+	cursor := NewSacctCursor(path, time.Minute)
+	start, end := cursor.Window(now)
+	assert.False(t, end.Before(start))
+	assert.True(t, end.Before(now))
+
+	// A restarted exporter continues at the end of the last polled window
+	cursor.Advance(end)
+	start, _ = NewSacctCursor(path, time.Minute).Window(now.Add(time.Hour))
+	assert.True(t, start.Equal(end))
+}
@@ -23,6 +23,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 /*
@@ -45,6 +46,21 @@ type SchedulerMetrics struct {
 	total_backfilled_jobs_since_start float64
 	total_backfilled_jobs_since_cycle float64
 	total_backfilled_heterogeneous    float64
+	agent_count                       float64
+	jobs_submitted                    float64
+	jobs_started                      float64
+	jobs_completed                    float64
+	jobs_canceled                     float64
+	jobs_failed                       float64
+	max_cycle                         float64
+	total_cycles                      float64
+	mean_depth_cycle                  float64
+	last_queue_length                 float64
+	backfill_max_cycle                float64
+	backfill_total_cycles             float64
+	backfill_last_queue_length        float64
+	// Time of the last reset of the statistics (Unix timestamp)
+	data_since float64
 }
 
 // Execute the sdiag command and return its output
@@ -64,60 +80,112 @@ func SchedulerData() []byte {
 	return out
 }
 
+// Parse the "Data since" timestamp like "Wed Apr 12 02:00:00 2017", recent
+// Slurm versions append the Unix timestamp like "(1491955200)"
+func ParseDataSince(field string) float64 {
+	field = strings.TrimSpace(field)
+	if i := strings.Index(field, "("); i >= 0 {
+		if since, err := strconv.ParseFloat(strings.Trim(field[i:], "()"), 64); err == nil {
+			return since
+		}
+		field = strings.TrimSpace(field[:i])
+	}
+	t, err := time.ParseInLocation("Mon Jan 2 15:04:05 2006", strings.Join(strings.Fields(field), " "), time.Local)
+	if err != nil {
+		return 0
+	}
+	return float64(t.Unix())
+}
+
 // Extract the relevant metrics from the sdiag output
 func ParseSchedulerMetrics(input []byte) *SchedulerMetrics {
 	var sm SchedulerMetrics
 	lines := strings.Split(string(input), "\n")
-	// Guard variables to check for string repetitions in the output of sdiag
-	// (two occurencies of the following strings: 'Last cycle', 'Mean cycle')
-	lc_count := 0
-	mc_count := 0
+	// Statistics like 'Last cycle' or 'Max cycle' are printed for the main
+	// scheduler first and repeated in the section of the backfill scheduler
+	backfill := false
 	for _, line := range lines {
+		if strings.HasPrefix(line, "Backfilling stats") {
+			backfill = true
+		}
+		if strings.HasPrefix(line, "Data since") {
+			sm.data_since = ParseDataSince(strings.TrimPrefix(line, "Data since"))
+			continue
+		}
 		if strings.Contains(line, ":") {
 			state := strings.Split(line, ":")[0]
+			value, _ := strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
 			st := regexp.MustCompile(`^Server thread`)
 			qs := regexp.MustCompile(`^Agent queue`)
+			ac := regexp.MustCompile(`^Agent count`)
 			dbd := regexp.MustCompile(`^DBD Agent`)
+			js := regexp.MustCompile(`^Jobs submitted`)
+			jst := regexp.MustCompile(`^Jobs started`)
+			jc := regexp.MustCompile(`^Jobs completed`)
+			jca := regexp.MustCompile(`^Jobs canceled`)
+			jf := regexp.MustCompile(`^Jobs failed`)
 			lc := regexp.MustCompile(`^[\s]+Last cycle$`)
+			mxc := regexp.MustCompile(`^[\s]+Max cycle$`)
+			tc := regexp.MustCompile(`^[\s]+Total cycles$`)
 			mc := regexp.MustCompile(`^[\s]+Mean cycle$`)
+			mdc := regexp.MustCompile(`^[\s]+Mean depth cycle$`)
 			cpm := regexp.MustCompile(`^[\s]+Cycles per`)
+			lql := regexp.MustCompile(`^[\s]+Last queue length$`)
 			dpm := regexp.MustCompile(`^[\s]+Depth Mean$`)
 			tbs := regexp.MustCompile(`^[\s]+Total backfilled jobs \(since last slurm start\)`)
 			tbc := regexp.MustCompile(`^[\s]+Total backfilled jobs \(since last stats cycle start\)`)
 			tbh := regexp.MustCompile(`^[\s]+Total backfilled heterogeneous job components`)
 			switch {
 			case st.MatchString(state) == true:
-				sm.threads, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
+				sm.threads = value
 			case qs.MatchString(state) == true:
-				sm.queue_size, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
+				sm.queue_size = value
+			case ac.MatchString(state) == true:
+				sm.agent_count = value
 			case dbd.MatchString(state) == true:
-				sm.dbd_queue_size, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
+				sm.dbd_queue_size = value
+			case js.MatchString(state) == true:
+				sm.jobs_submitted = value
+			case jst.MatchString(state) == true:
+				sm.jobs_started = value
+			case jc.MatchString(state) == true:
+				sm.jobs_completed = value
+			case jca.MatchString(state) == true:
+				sm.jobs_canceled = value
+			case jf.MatchString(state) == true:
+				sm.jobs_failed = value
+			case lc.MatchString(state) == true && backfill:
+				sm.backfill_last_cycle = value
 			case lc.MatchString(state) == true:
-				if lc_count == 0 {
-					sm.last_cycle, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
-					lc_count = 1
-				}
-				if lc_count == 1 {
-					sm.backfill_last_cycle, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
-				}
+				sm.last_cycle = value
+			case mxc.MatchString(state) == true && backfill:
+				sm.backfill_max_cycle = value
+			case mxc.MatchString(state) == true:
+				sm.max_cycle = value
+			case tc.MatchString(state) == true && backfill:
+				sm.backfill_total_cycles = value
+			case tc.MatchString(state) == true:
+				sm.total_cycles = value
+			case mc.MatchString(state) == true && backfill:
+				sm.backfill_mean_cycle = value
 			case mc.MatchString(state) == true:
-				if mc_count == 0 {
-					sm.mean_cycle, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
-					mc_count = 1
-				}
-				if mc_count == 1 {
-					sm.backfill_mean_cycle, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
-				}
+				sm.mean_cycle = value
+			case mdc.MatchString(state) == true:
+				sm.mean_depth_cycle = value
 			case cpm.MatchString(state) == true:
-				sm.cycle_per_minute, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
+				sm.cycle_per_minute = value
+			case lql.MatchString(state) == true && backfill:
+				sm.backfill_last_queue_length = value
+			case lql.MatchString(state) == true:
+				sm.last_queue_length = value
 			case dpm.MatchString(state) == true:
-				sm.backfill_depth_mean, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
+				sm.backfill_depth_mean = value
 			case tbs.MatchString(state) == true:
-				sm.total_backfilled_jobs_since_start, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
+				sm.total_backfilled_jobs_since_start = value
 			case tbc.MatchString(state) == true:
-				sm.total_backfilled_jobs_since_cycle, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
+				sm.total_backfilled_jobs_since_cycle = value
 			case tbh.MatchString(state) == true:
-				sm.total_backfilled_heterogeneous, _ = strconv.ParseFloat(strings.TrimSpace(strings.Split(line, ":")[1]), 64)
+				sm.total_backfilled_heterogeneous = value
 			}
 		}
 	}
@@ -149,6 +217,20 @@ type SchedulerCollector struct {
 	total_backfilled_jobs_since_start *prometheus.Desc
 	total_backfilled_jobs_since_cycle *prometheus.Desc
 	total_backfilled_heterogeneous    *prometheus.Desc
+	agent_count                       *prometheus.Desc
+	jobs_submitted                    *prometheus.Desc
+	jobs_started                      *prometheus.Desc
+	jobs_completed                    *prometheus.Desc
+	jobs_canceled                     *prometheus.Desc
+	jobs_failed                       *prometheus.Desc
+	max_cycle                         *prometheus.Desc
+	total_cycles                      *prometheus.Desc
+	mean_depth_cycle                  *prometheus.Desc
+	last_queue_length                 *prometheus.Desc
+	backfill_max_cycle                *prometheus.Desc
+	backfill_total_cycles             *prometheus.Desc
+	backfill_last_queue_length        *prometheus.Desc
+	data_since                        *prometheus.Desc
 }
 
 // Send all metric descriptions
@@ -165,6 +247,20 @@ func (c *SchedulerCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.total_backfilled_jobs_since_start
 	ch <- c.total_backfilled_jobs_since_cycle
 	ch <- c.total_backfilled_heterogeneous
+	ch <- c.agent_count
+	ch <- c.jobs_submitted
+	ch <- c.jobs_started
+	ch <- c.jobs_completed
+	ch <- c.jobs_canceled
+	ch <- c.jobs_failed
+	ch <- c.max_cycle
+	ch <- c.total_cycles
+	ch <- c.mean_depth_cycle
+	ch <- c.last_queue_length
+	ch <- c.backfill_max_cycle
+	ch <- c.backfill_total_cycles
+	ch <- c.backfill_last_queue_length
+	ch <- c.data_since
 }
 
 // Send the values of all metrics
@@ -179,9 +275,24 @@ func (sc *SchedulerCollector) Collect(ch chan<- prometheus.Metric) {
 	ch <- prometheus.MustNewConstMetric(sc.backfill_last_cycle, prometheus.GaugeValue, sm.backfill_last_cycle)
 	ch <- prometheus.MustNewConstMetric(sc.backfill_mean_cycle, prometheus.GaugeValue, sm.backfill_mean_cycle)
 	ch <- prometheus.MustNewConstMetric(sc.backfill_depth_mean, prometheus.GaugeValue, sm.backfill_depth_mean)
-	ch <- prometheus.MustNewConstMetric(sc.total_backfilled_jobs_since_start, prometheus.GaugeValue, sm.total_backfilled_jobs_since_start)
-	ch <- prometheus.MustNewConstMetric(sc.total_backfilled_jobs_since_cycle, prometheus.GaugeValue, sm.total_backfilled_jobs_since_cycle)
-	ch <- prometheus.MustNewConstMetric(sc.total_backfilled_heterogeneous, prometheus.GaugeValue, sm.total_backfilled_heterogeneous)
+	ch <- prometheus.MustNewConstMetric(sc.agent_count, prometheus.GaugeValue, sm.agent_count)
+	ch <- prometheus.MustNewConstMetric(sc.max_cycle, prometheus.GaugeValue, sm.max_cycle)
+	ch <- prometheus.MustNewConstMetric(sc.mean_depth_cycle, prometheus.GaugeValue, sm.mean_depth_cycle)
+	ch <- prometheus.MustNewConstMetric(sc.last_queue_length, prometheus.GaugeValue, sm.last_queue_length)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_max_cycle, prometheus.GaugeValue, sm.backfill_max_cycle)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_last_queue_length, prometheus.GaugeValue, sm.backfill_last_queue_length)
+	// Counters are reset by slurmctld at its start and at the time reported as "Data since"
+	ch <- prometheus.MustNewConstMetric(sc.total_backfilled_jobs_since_start, prometheus.CounterValue, sm.total_backfilled_jobs_since_start)
+	ch <- prometheus.MustNewConstMetric(sc.total_backfilled_jobs_since_cycle, prometheus.CounterValue, sm.total_backfilled_jobs_since_cycle)
+	ch <- prometheus.MustNewConstMetric(sc.total_backfilled_heterogeneous, prometheus.CounterValue, sm.total_backfilled_heterogeneous)
+	ch <- prometheus.MustNewConstMetric(sc.jobs_submitted, prometheus.CounterValue, sm.jobs_submitted)
+	ch <- prometheus.MustNewConstMetric(sc.jobs_started, prometheus.CounterValue, sm.jobs_started)
+	ch <- prometheus.MustNewConstMetric(sc.jobs_completed, prometheus.CounterValue, sm.jobs_completed)
+	ch <- prometheus.MustNewConstMetric(sc.jobs_canceled, prometheus.CounterValue, sm.jobs_canceled)
+	ch <- prometheus.MustNewConstMetric(sc.jobs_failed, prometheus.CounterValue, sm.jobs_failed)
+	ch <- prometheus.MustNewConstMetric(sc.total_cycles, prometheus.CounterValue, sm.total_cycles)
+	ch <- prometheus.MustNewConstMetric(sc.backfill_total_cycles, prometheus.CounterValue, sm.backfill_total_cycles)
+	ch <- prometheus.MustNewConstMetric(sc.data_since, prometheus.GaugeValue, sm.data_since)
 }
 
 // Returns the Slurm scheduler collector, used to register with the prometheus client
@@ -247,5 +358,75 @@ func NewSchedulerCollector() *SchedulerCollector {
 			"Information provided by the Slurm sdiag command, number of heterogeneous job components started thanks to backfilling since last Slurm start",
 			nil,
 			nil),
+		agent_count: prometheus.NewDesc(
+			"slurm_scheduler_agent_count",
+			"Information provided by the Slurm sdiag command, number of agent threads",
+			nil,
+			nil),
+		jobs_submitted: prometheus.NewDesc(
+			"slurm_scheduler_jobs_submitted_total",
+			"Information provided by the Slurm sdiag command, number of jobs submitted since the statistics were reset",
+			nil,
+			nil),
+		jobs_started: prometheus.NewDesc(
+			"slurm_scheduler_jobs_started_total",
+			"Information provided by the Slurm sdiag command, number of jobs started since the statistics were reset",
+			nil,
+			nil),
+		jobs_completed: prometheus.NewDesc(
+			"slurm_scheduler_jobs_completed_total",
+			"Information provided by the Slurm sdiag command, number of jobs completed since the statistics were reset",
+			nil,
+			nil),
+		jobs_canceled: prometheus.NewDesc(
+			"slurm_scheduler_jobs_canceled_total",
+			"Information provided by the Slurm sdiag command, number of jobs canceled since the statistics were reset",
+			nil,
+			nil),
+		jobs_failed: prometheus.NewDesc(
+			"slurm_scheduler_jobs_failed_total",
+			"Information provided by the Slurm sdiag command, number of jobs failed since the statistics were reset",
+			nil,
+			nil),
+		max_cycle: prometheus.NewDesc(
+			"slurm_scheduler_max_cycle",
+			"Information provided by the Slurm sdiag command, scheduler max cycle time in (microseconds)",
+			nil,
+			nil),
+		total_cycles: prometheus.NewDesc(
+			"slurm_scheduler_cycles_total",
+			"Information provided by the Slurm sdiag command, number of scheduler cycles since the statistics were reset",
+			nil,
+			nil),
+		mean_depth_cycle: prometheus.NewDesc(
+			"slurm_scheduler_mean_depth_cycle",
+			"Information provided by the Slurm sdiag command, scheduler mean number of jobs processed in a cycle",
+			nil,
+			nil),
+		last_queue_length: prometheus.NewDesc(
+			"slurm_scheduler_last_queue_length",
+			"Information provided by the Slurm sdiag command, number of jobs pending to be scheduled in the last cycle",
+			nil,
+			nil),
+		backfill_max_cycle: prometheus.NewDesc(
+			"slurm_scheduler_backfill_max_cycle",
+			"Information provided by the Slurm sdiag command, scheduler backfill max cycle time in (microseconds)",
+			nil,
+			nil),
+		backfill_total_cycles: prometheus.NewDesc(
+			"slurm_scheduler_backfill_cycles_total",
+			"Information provided by the Slurm sdiag command, number of scheduler backfill cycles since the statistics were reset",
+			nil,
+			nil),
+		backfill_last_queue_length: prometheus.NewDesc(
+			"slurm_scheduler_backfill_last_queue_length",
+			"Information provided by the Slurm sdiag command, number of jobs pending to be processed by the backfill scheduler in the last cycle",
+			nil,
+			nil),
+		data_since: prometheus.NewDesc(
+			"slurm_scheduler_stats_reset_time_seconds",
+			"Information provided by the Slurm sdiag command, time of the last reset of the statistics (Unix timestamp)",
+			nil,
+			nil),
 	}
 }
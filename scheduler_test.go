@@ -19,6 +19,9 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
 )
 
 func TestSchedulerMetrics(t *testing.T) {
@@ -28,7 +31,26 @@ func TestSchedulerMetrics(t *testing.T) {
 		t.Fatalf("Can not open test data: %v", err)
 	}
 	data, err := ioutil.ReadAll(file)
-	t.Logf("%+v", ParseSchedulerMetrics(data))
+	sm := ParseSchedulerMetrics(data)
+	t.Logf("%+v", sm)
+
+	// Statistics of the main scheduler are not overwritten by the backfill scheduler
+	assert.Equal(t, 97209.0, sm.last_cycle)
+	assert.Equal(t, 1942890.0, sm.backfill_last_cycle)
+	assert.Equal(t, 74593.0, sm.mean_cycle)
+	assert.Equal(t, 1960820.0, sm.backfill_mean_cycle)
+	assert.Equal(t, 1407590.0, sm.max_cycle)
+	assert.Equal(t, 5933334.0, sm.backfill_max_cycle)
+	assert.Equal(t, 34585.0, sm.total_cycles)
+	assert.Equal(t, 529.0, sm.backfill_total_cycles)
+	assert.Equal(t, 57011.0, sm.last_queue_length)
+	assert.Equal(t, 57064.0, sm.backfill_last_queue_length)
+	assert.Equal(t, 103.0, sm.mean_depth_cycle)
+	assert.Equal(t, 9706.0, sm.jobs_submitted)
+	assert.Equal(t, 2835.0, sm.jobs_canceled)
+	assert.Equal(t, 0.0, sm.agent_count)
+	assert.Equal(t, float64(time.Date(2017, 4, 12, 2, 0, 0, 0, time.Local).Unix()), sm.data_since)
+	assert.Equal(t, 1491955200.0, ParseDataSince("Wed Apr 12 02:00:00 2017 (1491955200)"))
 }
 
 func TestSchedulerGetMetrics(t *testing.T) {
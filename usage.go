@@ -0,0 +1,131 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// UsageKey groups the TRES usage of finished jobs
+type UsageKey struct {
+	account   string
+	user      string
+	partition string
+	tres      string
+}
+
+// ParseTRES takes a list of trackable resources like
+// "cpu=4,mem=16G,node=1,billing=4,gres/gpu=2" and returns the count per
+// resource, memory is converted to megabytes
+func ParseTRES(input string) map[string]float64 {
+	tres := make(map[string]float64)
+	for _, item := range strings.Split(strings.TrimSpace(input), ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		value := kv[1]
+		multiplier := 1.0
+		if kv[0] == "mem" {
+			switch {
+			case strings.HasSuffix(value, "K"):
+				multiplier = 1.0 / 1024
+			case strings.HasSuffix(value, "M"):
+				multiplier = 1
+			case strings.HasSuffix(value, "G"):
+				multiplier = 1024
+			case strings.HasSuffix(value, "T"):
+				multiplier = 1024 * 1024
+			}
+			value = strings.TrimRight(value, "KMGT")
+		}
+		count, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			continue
+		}
+		tres[kv[0]] += count * multiplier
+	}
+	return tres
+}
+
+// Fields requested from sacct for the TRES usage
+const usageFormat = "JobID,Account,User,Partition,AllocTRES,ElapsedRaw,End"
+
+// ParseUsageMetrics takes the output of sacct and returns the TRES-minutes
+// of all jobs which finished within the time window
+func ParseUsageMetrics(input []byte, start time.Time, end time.Time) map[UsageKey]float64 {
+	usage := make(map[UsageKey]float64)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, "|")
+		if len(fields) < 7 || !FinishedWithin(fields[6], start, end) {
+			continue
+		}
+		elapsed, _ := strconv.ParseFloat(fields[5], 64)
+		for tres, count := range ParseTRES(fields[4]) {
+			usage[UsageKey{fields[1], fields[2], fields[3], tres}] += count * elapsed / 60
+		}
+	}
+	return usage
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * TRES usage accumulated from the accounting database into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// NewUsageCollector returns a collector for the TRES usage of finished jobs,
+// the cursor is persisted to cursorPath unless it is empty
+func NewUsageCollector(cursorPath string, settle time.Duration) *UsageCollector {
+	labels := []string{"account", "user", "partition", "tres"}
+	return &UsageCollector{
+		cursor:  NewSacctCursor(cursorPath, settle),
+		usage:   make(map[UsageKey]float64),
+		minutes: prometheus.NewDesc("slurm_tres_usage_minutes_total", "TRES-minutes used by finished jobs, memory in megabyte-minutes", labels, nil),
+	}
+}
+
+type UsageCollector struct {
+	mutex   sync.Mutex
+	cursor  *SacctCursor
+	usage   map[UsageKey]float64
+	minutes *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (uc *UsageCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- uc.minutes
+}
+
+func (uc *UsageCollector) Collect(ch chan<- prometheus.Metric) {
+	uc.mutex.Lock()
+	defer uc.mutex.Unlock()
+	start, end := uc.cursor.Window(time.Now())
+	if end.After(start) {
+		for key, minutes := range ParseUsageMetrics(FinishedJobsData(start, end, usageFormat), start, end) {
+			uc.usage[key] += minutes
+		}
+		uc.cursor.Advance(end)
+	}
+	for key, minutes := range uc.usage {
+		ch <- prometheus.MustNewConstMetric(uc.minutes, prometheus.CounterValue, minutes, key.account, key.user, key.partition, key.tres)
+	}
+}
@@ -0,0 +1,50 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTRES(t *testing.T) {
+	tres := ParseTRES("cpu=4,mem=16G,node=1,billing=4,gres/gpu=2")
+	assert.Equal(t, 4.0, tres["cpu"])
+	assert.Equal(t, 16384.0, tres["mem"])
+	assert.Equal(t, 2.0, tres["gres/gpu"])
+	assert.Empty(t, ParseTRES(""))
+}
+
+func TestUsageMetrics(t *testing.T) {
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/sacct_usage.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	start := time.Date(2021, 3, 4, 10, 0, 0, 0, time.Local)
+	end := time.Date(2021, 3, 4, 11, 0, 0, 0, time.Local)
+	usage := ParseUsageMetrics(data, start, end)
+	t.Logf("%+v", usage)
+
+	// Job 4240 ended at the start of the window and job 4243 after its end
+	assert.Equal(t, 240.0, usage[UsageKey{"vision", "alice", "gpu", "cpu"}])
+	assert.Equal(t, 60.0, usage[UsageKey{"vision", "alice", "gpu", "gres/gpu"}])
+	assert.Equal(t, 64.0*1024*30, usage[UsageKey{"vision", "alice", "gpu", "mem"}])
+	assert.Equal(t, 40.0, usage[UsageKey{"chemistry", "bob", "batch", "billing"}])
+}
@@ -26,7 +26,7 @@ import (
 )
 
 func UsersData() []byte {
-        cmd := exec.Command("squeue","-a","-r","-h","-o %A|%u|%T|%C")
+        cmd := exec.Command("squeue","-a","-r","-h","-o %A|%u|%T|%C|%i")
         stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		log.Fatal(err)
@@ -64,7 +64,18 @@ func ParseUsersMetrics(input []byte) map[string]*UserJobMetrics {
                         pending := regexp.MustCompile(`^pending`)
                         running := regexp.MustCompile(`^running`)
                         suspended := regexp.MustCompile(`^suspended`)
+                        // The components of a heterogeneous job are counted as one job
+                        component := false
+                        if fields := strings.Split(line,"|"); len(fields) > 4 {
+                                _,offset,ok := HetJobComponent(fields[4])
+                                component = ok && offset > 0
+                        }
                         switch {
+                        case component && running.MatchString(state) == true:
+                                // only the CPUs of further components are accounted for
+                                users[user].running_cpus += cpus
+                        case component:
+                                // further components of jobs in other states are skipped
                         case pending.MatchString(state) == true:
                                 users[user].pending++
                         case running.MatchString(state) == true:
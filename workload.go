@@ -0,0 +1,227 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+/*
+ * Running jobs are classified into workloads by rules read from a file, one
+ * rule per line like "cryoem name ^relion_" assigning the workload "cryoem"
+ * to jobs with a name matching the regular expression "^relion_". The first
+ * matching rule wins, jobs not matching any rule are assigned to "other".
+ */
+
+// Fields of a job which can be matched by a rule, with their position in the output of WorkloadData
+var workloadFields = map[string]int{
+	"partition": 4,
+	"wckey":     5,
+	"workdir":   6,
+	"name":      7,
+	"comment":   8,
+}
+
+// Workload of the jobs not matching any rule
+const defaultWorkload = "other"
+
+// Job names, working directories and comments are free text and may contain
+// "|", the fields are therefore separated by the ASCII unit separator
+const workloadSeparator = "\x1f"
+
+type WorkloadRule struct {
+	workload string
+	field    string
+	pattern  *regexp.Regexp
+}
+
+// WorkloadKey groups the running jobs by workload, account and user
+type WorkloadKey struct {
+	workload string
+	account  string
+	user     string
+}
+
+type WorkloadMetrics struct {
+	running     float64
+	runningCPUs float64
+}
+
+// ParseWorkloadRules takes the content of a rules file, empty lines and lines
+// starting with "#" are skipped
+func ParseWorkloadRules(input []byte) ([]WorkloadRule, error) {
+	var rules []WorkloadRule
+	for i, line := range strings.Split(string(input), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		// The regular expression is the remainder of the line and may contain spaces
+		parts := strings.Fields(line)
+		if len(parts) < 3 {
+			return nil, fmt.Errorf("line %d: expected <workload> <field> <regex>", i+1)
+		}
+		if _, ok := workloadFields[parts[1]]; !ok {
+			return nil, fmt.Errorf("line %d: unknown field %s", i+1, parts[1])
+		}
+		// Cut the workload and field tokens off the front, both may occur in the regex or each other
+		expr := strings.TrimSpace(line[len(parts[0]):])
+		expr = strings.TrimSpace(expr[len(parts[1]):])
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", i+1, err)
+		}
+		rules = append(rules, WorkloadRule{parts[0], parts[1], pattern})
+	}
+	return rules, nil
+}
+
+// LoadWorkloadRules reads the rules from a file, no rules are returned if path is empty
+func LoadWorkloadRules(path string) ([]WorkloadRule, error) {
+	if len(path) == 0 {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rules, err := ParseWorkloadRules(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rules, nil
+}
+
+// ClassifyWorkload returns the workload of the first rule matching the fields of a job
+func ClassifyWorkload(rules []WorkloadRule, fields []string) string {
+	for _, rule := range rules {
+		if rule.pattern.MatchString(fields[workloadFields[rule.field]]) {
+			return rule.workload
+		}
+	}
+	return defaultWorkload
+}
+
+// Execute the squeue command to get the running jobs with the fields matched by the rules
+func WorkloadData() []byte {
+	format := strings.Join([]string{"%i", "%u", "%a", "%C", "%P", "%w", "%Z", "%j", "%k"}, workloadSeparator)
+	args := []string{"-a", "-r", "-h", "--states=RUNNING", "-o", format}
+	return Execute("squeue", args)
+}
+
+// ParseWorkloadMetrics takes the output of squeue for running jobs
+// It returns the running jobs and CPUs per workload, account and user
+func ParseWorkloadMetrics(input []byte, rules []WorkloadRule) map[WorkloadKey]*WorkloadMetrics {
+	workloads := make(map[WorkloadKey]*WorkloadMetrics)
+	for _, line := range strings.Split(string(input), "\n") {
+		fields := strings.Split(line, workloadSeparator)
+		if len(fields) != 9 {
+			continue
+		}
+		key := WorkloadKey{ClassifyWorkload(rules, fields), fields[2], fields[1]}
+		if _, ok := workloads[key]; !ok {
+			workloads[key] = &WorkloadMetrics{}
+		}
+		cpus, _ := strconv.ParseFloat(fields[3], 64)
+		workloads[key].runningCPUs += cpus
+		// The components of a heterogeneous job are counted as one job
+		if _, offset, ok := HetJobComponent(fields[0]); !ok || offset == 0 {
+			workloads[key].running++
+		}
+	}
+	return workloads
+}
+
+func WorkloadGetMetrics(rules []WorkloadRule) map[WorkloadKey]*WorkloadMetrics {
+	return ParseWorkloadMetrics(WorkloadData(), rules)
+}
+
+// SumWorkloads sums up the running jobs of all keys mapped to the same key by group,
+// e.g. to drop the user from the key
+func SumWorkloads(workloads map[WorkloadKey]*WorkloadMetrics, group func(WorkloadKey) WorkloadKey) map[WorkloadKey]*WorkloadMetrics {
+	sums := make(map[WorkloadKey]*WorkloadMetrics)
+	for key, wm := range workloads {
+		key = group(key)
+		if _, ok := sums[key]; !ok {
+			sums[key] = &WorkloadMetrics{}
+		}
+		sums[key].running += wm.running
+		sums[key].runningCPUs += wm.runningCPUs
+	}
+	return sums
+}
+
+/*
+ * Implement the Prometheus Collector interface and feed the
+ * workload metrics of running jobs into it.
+ * https://godoc.org/github.com/prometheus/client_golang/prometheus#Collector
+ */
+
+// NewWorkloadCollector returns the collector of the running jobs classified by
+// rules, squeue is executed once per scrape for all groupings of the workloads
+func NewWorkloadCollector(rules []WorkloadRule) *WorkloadCollector {
+	return &WorkloadCollector{
+		rules:              rules,
+		running:            prometheus.NewDesc("slurm_queue_workload_jobs_running", "Running jobs in the cluster by workload", []string{"workload"}, nil),
+		runningCPUs:        prometheus.NewDesc("slurm_queue_workload_cpus_running", "Running cpus in the cluster by workload", []string{"workload"}, nil),
+		accountRunning:     prometheus.NewDesc("slurm_account_workload_jobs_running", "Running jobs for account by workload", []string{"account", "workload"}, nil),
+		accountRunningCPUs: prometheus.NewDesc("slurm_account_workload_cpus_running", "Running cpus for account by workload", []string{"account", "workload"}, nil),
+		userRunning:        prometheus.NewDesc("slurm_user_workload_jobs_running", "Running jobs for user by workload", []string{"user", "workload"}, nil),
+		userRunningCPUs:    prometheus.NewDesc("slurm_user_workload_cpus_running", "Running cpus for user by workload", []string{"user", "workload"}, nil),
+	}
+}
+
+type WorkloadCollector struct {
+	rules              []WorkloadRule
+	running            *prometheus.Desc
+	runningCPUs        *prometheus.Desc
+	accountRunning     *prometheus.Desc
+	accountRunningCPUs *prometheus.Desc
+	userRunning        *prometheus.Desc
+	userRunningCPUs    *prometheus.Desc
+}
+
+// Send all metric descriptions
+func (wc *WorkloadCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wc.running
+	ch <- wc.runningCPUs
+	ch <- wc.accountRunning
+	ch <- wc.accountRunningCPUs
+	ch <- wc.userRunning
+	ch <- wc.userRunningCPUs
+}
+
+func (wc *WorkloadCollector) Collect(ch chan<- prometheus.Metric) {
+	workloads := WorkloadGetMetrics(wc.rules)
+	for key, wm := range SumWorkloads(workloads, func(key WorkloadKey) WorkloadKey { return WorkloadKey{workload: key.workload} }) {
+		ch <- prometheus.MustNewConstMetric(wc.running, prometheus.GaugeValue, wm.running, key.workload)
+		ch <- prometheus.MustNewConstMetric(wc.runningCPUs, prometheus.GaugeValue, wm.runningCPUs, key.workload)
+	}
+	for key, wm := range SumWorkloads(workloads, func(key WorkloadKey) WorkloadKey { return WorkloadKey{workload: key.workload, account: key.account} }) {
+		ch <- prometheus.MustNewConstMetric(wc.accountRunning, prometheus.GaugeValue, wm.running, key.account, key.workload)
+		ch <- prometheus.MustNewConstMetric(wc.accountRunningCPUs, prometheus.GaugeValue, wm.runningCPUs, key.account, key.workload)
+	}
+	for key, wm := range SumWorkloads(workloads, func(key WorkloadKey) WorkloadKey { return WorkloadKey{workload: key.workload, user: key.user} }) {
+		ch <- prometheus.MustNewConstMetric(wc.userRunning, prometheus.GaugeValue, wm.running, key.user, key.workload)
+		ch <- prometheus.MustNewConstMetric(wc.userRunningCPUs, prometheus.GaugeValue, wm.runningCPUs, key.user, key.workload)
+	}
+}
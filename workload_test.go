@@ -0,0 +1,72 @@
+/* Copyright 2021 Victor Penso, Matteo Dessalvi
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+
+This program is distributed in the hope that it will be useful,
+but WITHOUT ANY WARRANTY; without even the implied warranty of
+MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+GNU General Public License for more details.
+
+You should have received a copy of the GNU General Public License
+along with this program.  If not, see <http://www.gnu.org/licenses/>. */
+
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWorkloadRules(t *testing.T) {
+	rules, err := LoadWorkloadRules("test_data/workload_rules.txt")
+	assert.NoError(t, err)
+	assert.Len(t, rules, 6)
+	assert.Equal(t, "(?i)openfoam run", rules[4].pattern.String())
+
+	_, err = ParseWorkloadRules([]byte("cfd account ^cfd$"))
+	assert.Error(t, err)
+	_, err = ParseWorkloadRules([]byte("cfd name ("))
+	assert.Error(t, err)
+	_, err = ParseWorkloadRules([]byte("cfd name"))
+	assert.Error(t, err)
+
+	// The field name may be part of the workload name
+	rules, err = ParseWorkloadRules([]byte("named name ^relion_\nworkdir_jobs workdir ^/lustre/"))
+	assert.NoError(t, err)
+	assert.Equal(t, "^relion_", rules[0].pattern.String())
+	assert.Equal(t, "workdir", rules[1].field)
+	assert.Equal(t, "^/lustre/", rules[1].pattern.String())
+
+	rules, err = LoadWorkloadRules("")
+	assert.NoError(t, err)
+	assert.Nil(t, rules)
+}
+
+func TestWorkloadMetrics(t *testing.T) {
+	rules, err := LoadWorkloadRules("test_data/workload_rules.txt")
+	if err != nil {
+		t.Fatalf("Can not load rules: %v", err)
+	}
+	// Read the input data from a file
+	data, err := ioutil.ReadFile("test_data/squeue_workload.txt")
+	if err != nil {
+		t.Fatalf("Can not open test data: %v", err)
+	}
+	workloads := ParseWorkloadMetrics(data, rules)
+	t.Logf("%+v", workloads)
+
+	assert.Len(t, workloads, 5)
+	assert.Equal(t, &WorkloadMetrics{running: 2, runningCPUs: 80}, workloads[WorkloadKey{"cryoem", "vision", "alice"}])
+	// The first matching rule wins
+	assert.Equal(t, &WorkloadMetrics{running: 1, runningCPUs: 1}, workloads[WorkloadKey{"jupyter", "chemistry", "bob"}])
+	assert.Equal(t, &WorkloadMetrics{running: 1, runningCPUs: 2}, workloads[WorkloadKey{"interactive", "chemistry", "bob"}])
+	// Heterogeneous jobs are counted once with the CPUs of all components, a job
+	// name containing "|" does not shift the wckey of the following fields
+	assert.Equal(t, &WorkloadMetrics{running: 3, runningCPUs: 960}, workloads[WorkloadKey{"cfd", "physics", "carol"}])
+	assert.Equal(t, &WorkloadMetrics{running: 1, runningCPUs: 8}, workloads[WorkloadKey{"other", "chemistry", "bob"}])
+}